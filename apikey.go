@@ -1,23 +1,27 @@
 package apikey
 
 import (
-	"crypto/rand"
 	"crypto/sha512"
 	"crypto/subtle"
 	"encoding/hex"
-	"errors"
+	"io"
 	"strings"
 	"unicode/utf8"
 )
 
 const (
-	// DefaultSecretBytes is the number of random bytes used for the secret part
+	// DefaultSecretBytes is the number of symbols in the secret part. Each
+	// symbol is drawn uniformly from userFriendlyAlphabet, consuming at least
+	// one random byte (see randomSymbols).
 	DefaultSecretBytes = 20
 	// MaxPrefixLen is the maximum prefix length allowed (matches DB varchar(16))
 	MaxPrefixLen = 16
 	// SecretSymbolLen is the exact number of non-dash symbols required in a
 	// valid user-facing secret. This is enforced in isValidSecret.
 	SecretSymbolLen = DefaultSecretBytes
+	// SecretEntropyBits is the entropy, rounded down, of a secret generated by
+	// GenerateApiKey: SecretSymbolLen * log2(31) ~= 99.08 bits.
+	SecretEntropyBits = 99
 )
 
 // internal constants
@@ -25,8 +29,7 @@ const (
 	separator = "_"
 
 	// userFriendlyAlphabet is a Base32-like alphabet without ambiguous chars.
-	// We don't implement full RFC 4648 padding; we just map random bytes into
-	// these characters, which is sufficient for a human-facing secret.
+	// It has 31 symbols, so each one carries log2(31) ~= 4.95 bits.
 	userFriendlyAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789" // no I,L,O,0,1
 )
 
@@ -39,81 +42,97 @@ const (
 //     safe for copy/paste by end users.
 //   - prefix: a lowercase hex string of length prefixLen (or MaxPrefixLen when
 //     prefixLen is out of range).
-//   - hash: the SHA-512 digest of the secret, hex-encoded.
+//   - hash: the SHA-512 digest of the secret as returned by
+//     HashApiKeySecret, "$sha512$v=2$<hex>" (140 characters). Keyed digests
+//     from a Keyring or HashApiKeySecretHMAC are at most 180 characters.
 //
 // The returned secret is the user-facing sensitive value and is embedded in
 // fullKey after the underscore. No raw binary data is ever returned to callers.
 // If prefixLen is <=0 or > MaxPrefixLen it will be clamped to MaxPrefixLen.
 func GenerateApiKey(prefixLen int) (fullKey, prefix, hash string, err error) {
-	if prefixLen <= 0 || prefixLen > MaxPrefixLen {
-		prefixLen = MaxPrefixLen
-	}
-
-	// Generate the secret bytes and encode as user-friendly secret
-	b := make([]byte, DefaultSecretBytes)
-	if _, err = rand.Read(b); err != nil {
+	k, err := GenerateKey(KeySpec{PrefixLen: prefixLen})
+	if err != nil {
 		return "", "", "", err
 	}
-	secret := encodeUserFriendly(b)
+	return k.String(), k.Prefix(), k.Digest(), nil
+}
 
-	// Generate an independent random prefix (hex), not derived from secret
-	// Ensure we have enough hex characters, so generate ceil(prefixLen/2) bytes
-	prefixBytes := (prefixLen + 1) / 2
-	pb := make([]byte, prefixBytes)
-	if _, err = rand.Read(pb); err != nil {
+// GenerateApiKeyWithChecksum behaves like GenerateApiKey but appends a
+// checksum segment to the full key:
+//
+//	<prefix>_<secret>_<checksum>
+//
+// The checksum is ChecksumLen symbols from the same alphabet as the secret and
+// lets ParseApiKey reject mistyped keys before any storage lookup. The digest
+// covers the secret only, so it is identical to the one GenerateApiKey would
+// return for the same secret.
+func GenerateApiKeyWithChecksum(prefixLen int) (fullKey, prefix, hash string, err error) {
+	k, err := GenerateKey(KeySpec{PrefixLen: prefixLen, Checksum: true})
+	if err != nil {
 		return "", "", "", err
 	}
-	prefixHex := hex.EncodeToString(pb)
-	prefix = prefixHex[:prefixLen]
-
-	fullKey = prefix + separator + secret
-
-	h := sha512.Sum512([]byte(secret))
-	hash = hex.EncodeToString(h[:])
-	return
+	return k.String(), k.Prefix(), k.Digest(), nil
 }
 
-// HashApiKeySecret returns the SHA-512 hex digest of the user-friendly secret
-// string. The returned value is a lowercase hex-encoded string, safe for
-// storage in TEXT/VARCHAR columns.
+// HashApiKeySecret returns the SHA-512 digest of the user-friendly secret
+// string. Dashes are ignored, so "ABCD-EFGH-..." and "ABCDEFGH..." have the
+// same digest. The result is self-describing and safe for storage in
+// TEXT/VARCHAR columns:
+//
+//	$sha512$v=2$<hex>
+//
+// Digests from earlier releases (bare SHA-512 hex of the dashed secret) are
+// still accepted by ValidateApiKey and the other validation functions.
 func HashApiKeySecret(secret string) string {
-	h := sha512.Sum512([]byte(secret))
-	return hex.EncodeToString(h[:])
+	d, _ := computeDigest(DigestSHA512, currentDigestVersion, secret, nil)
+	return d.String()
 }
 
 // ParseApiKey splits a fullKey into prefix and secret.
-// fullKey is expected to be "prefix_secret" where both parts are text-safe
-// UTF-8 strings. The returned secret is the user-friendly secret portion as
-// produced by GenerateApiKey and must be treated as sensitive.
+// fullKey is expected to be one of
+//
+//	<prefix>_<secret>
+//	<prefix>_<secret>_<checksum>
+//	<vendor>_<prefix>_<secret>_<checksum>
+//	<vendor>_<kind>_<prefix>_<secret>_<checksum>
+//	<prefix>.<secretHex>  (legacy FormatV0)
+//
+// where all parts are text-safe UTF-8 strings. fullKey is first normalised
+// with NormalizeApiKey, so case, whitespace, dash variants and look-alike
+// characters typed by a person are tolerated. When a checksum segment is
+// present it is verified and ErrChecksumMismatch is returned if it does not
+// match. The returned secret is the user-friendly secret portion as produced
+// by GenerateApiKey and must be treated as sensitive.
 func ParseApiKey(fullKey string) (prefix, secret string, err error) {
-	if fullKey == "" {
-		return "", "", errors.New("empty key")
-	}
-	idx := strings.Index(fullKey, separator)
-	if idx <= 0 || idx >= len(fullKey)-1 {
-		return "", "", errors.New("invalid key format")
-	}
-	prefix = fullKey[:idx]
-	secret = fullKey[idx+1:]
-	if !isValidPrefix(prefix) || !isValidSecret(secret) {
-		return "", "", errors.New("invalid key format")
+	k, err := ParseKey(fullKey)
+	if err != nil {
+		return "", "", err
 	}
-	return
+	return k.Prefix(), k.Secret(), nil
 }
 
 // ValidateApiKey checks that fullKey (API Key) matches the provided storedHash
-// (hex SHA-512 of the user-friendly secret). It returns true when they match;
-// comparison is done in constant time. storedHash is expected to be the result
-// of HashApiKeySecret and is always a hex-encoded string.
+// (the unkeyed SHA-512 digest of the user-friendly secret). It returns true
+// when they match; comparison is done in constant time. storedHash is
+// expected to be the result of HashApiKeySecret, or a bare hex digest from an
+// earlier release. Keyed digests from HashApiKeySecretHMAC must be checked
+// with ValidateApiKeyHMAC instead.
 func ValidateApiKey(fullKey, storedHash string) (bool, error) {
 	_, secret, err := ParseApiKey(fullKey)
 	if err != nil {
 		return false, err
 	}
 	if secret == "" {
-		return false, errors.New("empty secret")
+		return false, keyError(ErrEmpty, "secret", "empty secret")
 	}
-	h := HashApiKeySecret(secret)
+	if strings.HasPrefix(storedHash, digestMarker) {
+		if d, err := parseDigest(storedHash); err == nil && d.alg.keyed() {
+			return false, keyError(ErrPepperRequired, "digest", "keyed digest needs ValidateApiKeyHMAC")
+		}
+		return verifySecret(secret, storedHash, nil)
+	}
+	sum := sha512.Sum512([]byte(secret))
+	h := hex.EncodeToString(sum[:])
 	// constant time compare
 	if len(h) != len(storedHash) {
 		return false, nil
@@ -124,31 +143,38 @@ func ValidateApiKey(fullKey, storedHash string) (bool, error) {
 	return false, nil
 }
 
-// encodeUserFriendly maps random bytes into a user-friendly alphabet and
-// groups them with dashes for readability.
-func encodeUserFriendly(b []byte) string {
-	if len(b) == 0 {
-		return ""
-	}
-	alphabetLen := byte(len(userFriendlyAlphabet))
-	var sb strings.Builder
-	count := 0
-	for _, v := range b {
-		idx := int(v % alphabetLen)
-		ch := userFriendlyAlphabet[idx]
-		sb.WriteByte(byte(ch))
-		count++
-		// insert dash every 4 chars for readability
-		if count%4 == 0 {
-			sb.WriteByte('-')
+// randomSymbols returns n symbols drawn uniformly from alphabet using bytes
+// read from r. Bytes that would introduce modulo bias (those at or above the
+// largest multiple of len(alphabet) below 256) are rejected and redrawn.
+func randomSymbols(r io.Reader, alphabet string, n int) (string, error) {
+	if n <= 0 {
+		return "", nil
+	}
+	limit := 256 - 256%len(alphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := io.ReadFull(r, buf[:n-len(out)]); err != nil {
+			return "", err
+		}
+		for _, v := range buf[:n-len(out)] {
+			if int(v) < limit {
+				out = append(out, alphabet[int(v)%len(alphabet)])
+			}
 		}
 	}
-	secret := sb.String()
-	// trim trailing dash if we ended exactly on a group boundary
-	if strings.HasSuffix(secret, "-") {
-		secret = secret[:len(secret)-1]
+	return string(out), nil
+}
+
+// randomPrefix returns an independent random lowercase hex prefix of n
+// characters read from r, not derived from the secret.
+func randomPrefix(r io.Reader, n int) (string, error) {
+	// Ensure we have enough hex characters, so generate ceil(n/2) bytes
+	b := make([]byte, (n+1)/2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
 	}
-	return secret
+	return hex.EncodeToString(b)[:n], nil
 }
 
 // isValidPrefix validates the prefix format: non-empty, lowercase hex, and not
@@ -171,24 +197,7 @@ func isValidPrefix(p string) bool {
 // After removing dashes, the secret must have exactly SecretSymbolLen
 // characters.
 func isValidSecret(s string) bool {
-	if s == "" {
-		return false
-	}
-	plainCount := 0
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c == '-' {
-			continue
-		}
-		plainCount++
-		if !strings.ContainsRune(userFriendlyAlphabet, rune(c)) {
-			return false
-		}
-	}
-	if plainCount != SecretSymbolLen {
-		return false
-	}
-	return true
+	return defaultLayout.validSecret(s)
 }
 
 // internal helper to assert that strings we generate are valid UTF-8 and contain no NUL
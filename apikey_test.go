@@ -1,6 +1,7 @@
 package apikey
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 )
@@ -63,6 +64,9 @@ func TestHashSecret(t *testing.T) {
 	if !isTextSafe(h) {
 		t.Fatalf("hash is not text-safe")
 	}
+	if !strings.HasPrefix(h, "$sha512$v=2$") || len(h) != 140 {
+		t.Fatalf("hash %q is not a 140-character v2 digest", h)
+	}
 	// same input should produce same hash
 	h2 := HashApiKeySecret(s)
 	if h != h2 {
@@ -80,11 +84,12 @@ func TestValidateBad(t *testing.T) {
 		t.Fatalf("hash too short")
 	}
 	b := []rune(hash)
-	// flip the first rune to something different
-	if b[0] != '0' {
-		b[0] = '0'
+	// flip the last hex rune to something different
+	last := len(b) - 1
+	if b[last] != '0' {
+		b[last] = '0'
 	} else {
-		b[0] = '1'
+		b[last] = '1'
 	}
 	bad := string(b)
 	ok, err := ValidateApiKey(full, bad)
@@ -150,16 +155,16 @@ func TestGenerateApiKey_SecretFormat(t *testing.T) {
 }
 
 func TestParseApiKey_InvalidSecretChars(t *testing.T) {
-	// lowercase letters in secret should be rejected
-	full := "abcd12_abcD-efgh-IJKL-MNPQ"
+	// characters outside the alphabet that normalisation cannot map should be
+	// rejected
+	full := "abcd12_ABCD-EF#H-JKMN-PQRS-TUVW"
 	if _, _, err := ParseApiKey(full); err == nil {
-		t.Fatalf("expected error for secret with invalid characters (lowercase)")
+		t.Fatalf("expected error for secret with invalid characters")
 	}
 
-	// forbidden characters (e.g., 'O', '0', 'I', '1', 'L') should be rejected
-	full = "abcd12_ABCD-EF0H-IJKL-MNPQ"
+	full = "abcd12_ABCD-EFÜH-JKMN-PQRS-TUVW"
 	if _, _, err := ParseApiKey(full); err == nil {
-		t.Fatalf("expected error for secret with forbidden characters")
+		t.Fatalf("expected error for secret with non-ASCII characters")
 	}
 }
 
@@ -181,7 +186,7 @@ func TestParseApiKey_InvalidSecretLength(t *testing.T) {
 
 func TestValidateApiKey_InvalidSecretFormat(t *testing.T) {
 	// malformed secret should cause ValidateApiKey to return false with an error
-	full := "abcd12_ABCD-efgh-IJKL-MNPQ" // lowercase in secret
+	full := "abcd12_ABCD-EF#H-JKMN-PQRS-TUVW" // invalid character in secret
 	ok, err := ValidateApiKey(full, strings.Repeat("0", 128))
 	if err == nil {
 		t.Fatalf("expected error from ValidateApiKey for malformed secret")
@@ -190,3 +195,19 @@ func TestValidateApiKey_InvalidSecretFormat(t *testing.T) {
 		t.Fatalf("expected ok=false for malformed secret")
 	}
 }
+
+func TestRandomSymbols_RejectsBiasedBytes(t *testing.T) {
+	// 255 and 248 fall in the biased tail (>= 248) and must be skipped.
+	r := bytes.NewReader([]byte{255, 248, 0, 30, 247, 31})
+	s, err := randomSymbols(r, userFriendlyAlphabet, 4)
+	if err != nil {
+		t.Fatalf("randomSymbols error: %v", err)
+	}
+	want := string([]byte{userFriendlyAlphabet[0], userFriendlyAlphabet[30], userFriendlyAlphabet[30], userFriendlyAlphabet[0]})
+	if s != want {
+		t.Fatalf("randomSymbols = %q, want %q", s, want)
+	}
+	if _, err := randomSymbols(bytes.NewReader([]byte{255, 255}), userFriendlyAlphabet, 1); err == nil {
+		t.Fatalf("expected error when the reader runs dry")
+	}
+}
@@ -0,0 +1,141 @@
+package apikey
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argonPHCPrefix starts every PHC-formatted Argon2id hash.
+const argonPHCPrefix = "$argon2id$"
+
+// minArgonSumLen is the shortest derived key a stored hash may carry; shorter
+// ones are rejected as malformed rather than compared.
+const minArgonSumLen = 16
+
+// argonParams are the cost parameters of an Argon2id hash.
+type argonParams struct {
+	memory   uint32
+	time     uint32
+	parallel uint8
+}
+
+// orDefault returns p with its zero fields taken from def.
+func (p argonParams) orDefault(def argonParams) argonParams {
+	if p.memory == 0 {
+		p.memory = def.memory
+	}
+	if p.time == 0 {
+		p.time = def.time
+	}
+	if p.parallel == 0 {
+		p.parallel = def.parallel
+	}
+	return p
+}
+
+// LogValue implements slog.LogValuer.
+func (p argonParams) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("m", uint64(p.memory)),
+		slog.Uint64("t", uint64(p.time)),
+		slog.Uint64("p", uint64(p.parallel)),
+	)
+}
+
+// argonHash is a decoded PHC-formatted Argon2id hash:
+//
+//	$argon2id$v=19$m=<mem>,t=<time>,p=<par>$<saltB64>$<hashB64>
+type argonHash struct {
+	argonParams
+	salt []byte
+	sum  []byte
+}
+
+// newArgonHash derives an Argon2id key of keyLen bytes from input.
+func newArgonHash(input, salt []byte, p argonParams, keyLen uint32) argonHash {
+	return argonHash{
+		argonParams: p,
+		salt:        salt,
+		sum:         argon2.IDKey(input, salt, p.time, p.memory, p.parallel, keyLen),
+	}
+}
+
+// String returns the PHC encoding of h.
+func (h argonHash) String() string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argonPHCPrefix, argon2.Version,
+		h.memory, h.time, h.parallel,
+		base64.RawStdEncoding.EncodeToString(h.salt),
+		base64.RawStdEncoding.EncodeToString(h.sum))
+}
+
+// matches reports in constant time whether input derives to h.
+func (h argonHash) matches(input []byte) bool {
+	got := argon2.IDKey(input, h.salt, h.time, h.memory, h.parallel, uint32(len(h.sum)))
+	return subtle.ConstantTimeCompare(got, h.sum) == 1
+}
+
+// parseArgonHash decodes a PHC-formatted Argon2id hash. Failures are reported
+// through fail, which is passwordError or bootstrapError.
+func parseArgonHash(phc string, fail func(err error, field, reason string) error) (argonHash, error) {
+	var h argonHash
+	if !strings.HasPrefix(phc, argonPHCPrefix) {
+		return h, fail(ErrUnsupportedHash, "hash", "unsupported hash format")
+	}
+	parts := strings.Split(phc, "$")
+	// parts: ["", "argon2id", "v=19", "m=..,t=..,p=..", "<salt>", "<hash>"]
+	if len(parts) != 6 {
+		return h, fail(ErrMalformedHash, "hash", "invalid phc format")
+	}
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return h, fail(ErrUnsupportedHash, "version", "unsupported argon2 version")
+	}
+	for _, kv := range strings.Split(parts[3], ",") {
+		kvp := strings.SplitN(kv, "=", 2)
+		if len(kvp) != 2 {
+			return h, fail(ErrMalformedHash, "params", "invalid argon2 params")
+		}
+		switch kvp[0] {
+		case "m":
+			mv, err := strconv.ParseUint(kvp[1], 10, 32)
+			if err != nil {
+				return h, fail(ErrMalformedHash, "params", "invalid memory parameter")
+			}
+			h.memory = uint32(mv)
+		case "t":
+			iv, err := strconv.ParseUint(kvp[1], 10, 32)
+			if err != nil {
+				return h, fail(ErrMalformedHash, "params", "invalid time parameter")
+			}
+			h.time = uint32(iv)
+		case "p":
+			pv, err := strconv.ParseUint(kvp[1], 10, 8)
+			if err != nil {
+				return h, fail(ErrMalformedHash, "params", "invalid parallelism parameter")
+			}
+			h.parallel = uint8(pv)
+		default:
+			return h, fail(ErrUnsupportedHash, "params", "unknown argon2 param")
+		}
+	}
+	// argon2.IDKey panics on a zero time or parallelism.
+	if h.memory == 0 || h.time == 0 || h.parallel == 0 {
+		return h, fail(ErrMalformedHash, "params", "missing or zero argon2 param")
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(h.salt) == 0 {
+		return h, fail(ErrMalformedHash, "salt", "invalid salt encoding")
+	}
+	if h.sum, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return h, fail(ErrMalformedHash, "hash", "invalid hash encoding")
+	}
+	if len(h.sum) < minArgonSumLen {
+		return h, fail(ErrMalformedHash, "hash", "derived key too short")
+	}
+	return h, nil
+}
@@ -3,15 +3,77 @@ package apikey
 import (
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/hex"
 	"errors"
-	"fmt"
-	"golang.org/x/crypto/argon2"
+	"io"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 )
 
+// DefaultBootstrapTTL is how long bootstrap secrets stay valid unless
+// WithTTL is used.
+const DefaultBootstrapTTL = 24 * time.Hour
+
+// Bootstrap secret and hash sizes.
+const (
+	bootstrapSecretLen = 32 // bytes
+	bootstrapSaltLen   = 16 // bytes
+	bootstrapKeyLen    = 32 // bytes
+)
+
+// bootstrapDomain separates keyed bootstrap digests from API key digests
+// computed with the same keyring.
+const bootstrapDomain = "apikey/bootstrap-token/v1"
+
+// bootstrapArgonParams are the parameters BootstrapIssuer uses unless
+// WithArgon2Params is given. Legacy "<salt-hex>:<hash-hex>" hashes were all
+// derived with them.
+var bootstrapArgonParams = argonParams{memory: 64 * 1024, time: 1, parallel: 4}
+
+// BootstrapIssuer creates and validates bootstrap secrets. Use
+// NewBootstrapIssuer to create one; GenerateBootstrap uses a BootstrapIssuer
+// with default settings.
+type BootstrapIssuer struct {
+	rand    io.Reader
+	now     func() time.Time
+	ttl     time.Duration
+	log     *slog.Logger
+	params  argonParams
+	keyring *Keyring
+}
+
+// BootstrapIssuerOption configures a BootstrapIssuer.
+type BootstrapIssuerOption interface {
+	applyBootstrapIssuer(*BootstrapIssuer)
+}
+
+// bootstrapOptionFunc adapts a function to BootstrapIssuerOption.
+type bootstrapOptionFunc func(*BootstrapIssuer)
+
+func (f bootstrapOptionFunc) applyBootstrapIssuer(b *BootstrapIssuer) { f(b) }
+
+// WithTTL sets how long secrets from the issuer stay valid. Non-positive
+// values select DefaultBootstrapTTL.
+func WithTTL(ttl time.Duration) BootstrapIssuerOption {
+	return bootstrapOptionFunc(func(b *BootstrapIssuer) { b.ttl = ttl })
+}
+
+// NewBootstrapIssuer returns a BootstrapIssuer configured by opts. Secrets
+// and salts are read from crypto/rand unless WithRand is given, and expiry is
+// computed from time.Now unless WithClock is given.
+func NewBootstrapIssuer(opts ...BootstrapIssuerOption) *BootstrapIssuer {
+	b := &BootstrapIssuer{rand: rand.Reader, now: time.Now, ttl: DefaultBootstrapTTL, log: discardLogger, params: bootstrapArgonParams}
+	for _, opt := range opts {
+		opt.applyBootstrapIssuer(b)
+	}
+	if b.ttl <= 0 {
+		b.ttl = DefaultBootstrapTTL
+	}
+	return b
+}
+
 // GenerateBootstrap creates a new one-off bootstrap secret suitable for
 // securely provisioning a client or account.
 //
@@ -20,40 +82,72 @@ import (
 //     once to the client (or used in the initial bootstrap request). This
 //     value is **not** stored server-side and must be treated as sensitive.
 //   - hash: a persistent representation of the secret for storage in the
-//     database. The format is:
-//     <salt-hex><colonString><argon2id-hash-hex>
-//     where:
-//   - salt-hex is a 16-byte random salt, hex-encoded.
-//   - argon2id-hash-hex is the Argon2ID-derived key of sha256(secret)
-//     with the generated salt, using parameters time=1, memory=64*1024 KiB,
-//     threads=4, keyLen=32. This value is suitable for storage in
-//     TEXT/VARCHAR columns.
-//   - expires: a UTC timestamp set to 24 hours from the time of generation.
-//     Callers should persist this value and refuse bootstrap tokens that
-//     are presented after this time.
+//     database: the Argon2ID-derived key of sha256(secret) with a 16-byte
+//     random salt, in the PHC format HashPassword uses:
+//     $argon2id$v=19$m=<mem>,t=<time>,p=<par>$<saltB64>$<hashB64>
+//     The parameters default to time=1, memory=64*1024 KiB, threads=4 and
+//     keyLen=32, and are read back from the hash on validation, so they can
+//     be tuned with WithArgon2Params without invalidating outstanding
+//     secrets. This value is suitable for storage in TEXT/VARCHAR columns.
+//   - expires: a UTC timestamp set to DefaultBootstrapTTL (24 hours) from
+//     the time of generation. Callers should persist this value and pass it
+//     to BootstrapIssuer.Validate, which refuses tokens presented at or
+//     after this time.
 //   - err: a non-nil error if a cryptographically secure random value could
 //     not be generated for either the secret or the salt.
 //
 // The generated secret and salt use crypto/rand for randomness. On error,
 // plain, hash, and expires are left at their zero values and err is set.
 func GenerateBootstrap() (plain, hash string, expires time.Time, err error) {
-	secret := make([]byte, 32)
-	if _, err = rand.Read(secret); err != nil {
-		fmt.Println(err)
+	return NewBootstrapIssuer().Generate()
+}
+
+// GenerateBootstrapFor behaves like GenerateBootstrap but binds the secret
+// to claims: the hash only validates with ValidateBootstrapFor and the same
+// claims.
+func GenerateBootstrapFor(claims BootstrapClaims) (plain, hash string, expires time.Time, err error) {
+	return NewBootstrapIssuer().GenerateFor(claims)
+}
+
+// Generate behaves like GenerateBootstrap, reading the secret and salt from
+// b's randomness source and setting expires to b's clock plus its TTL. A
+// failing read is returned unchanged. With WithKeyring, hash is a keyed
+// digest "$<alg>$v=2$k=<id>$<hex>" of the secret under the keyring's current
+// pepper, and no salt is read.
+func (b *BootstrapIssuer) Generate() (plain, hash string, expires time.Time, err error) {
+	return b.GenerateFor(BootstrapClaims{})
+}
+
+// GenerateFor behaves like Generate but binds the secret to claims, as
+// GenerateBootstrapFor does.
+func (b *BootstrapIssuer) GenerateFor(claims BootstrapClaims) (plain, hash string, expires time.Time, err error) {
+	secret := make([]byte, bootstrapSecretLen)
+	if _, err = io.ReadFull(b.rand, secret); err != nil {
+		b.log.Error("bootstrap generation failed", slog.Any("err", err))
 		return
 	}
 	plain = hex.EncodeToString(secret)
-	// IMPORTANT: We hash the raw secret bytes, not the hex string
-	sum := sha256.Sum256(secret)
-	salt := make([]byte, 16)
-	if _, err = rand.Read(salt); err != nil {
-		fmt.Println(err)
+	if b.keyring != nil {
+		if hash, err = b.keyring.bootstrapDigest(bootstrapHMACInput(secret, claims)); err != nil {
+			err = asBootstrapError(err)
+			b.log.Error("bootstrap generation failed", slog.Any("err", err))
+			return "", "", time.Time{}, err
+		}
+		expires = b.now().UTC().Add(b.ttl)
+		b.log.Info("bootstrap generated", slog.Time("expires", expires), slog.String("pepper", b.keyring.Current()), slog.Any("claims", claims))
 		return
 	}
+	// IMPORTANT: We hash the raw secret bytes, not the hex string
+	sum := bootstrapArgonInput(secret, claims)
+	salt := make([]byte, bootstrapSaltLen)
+	if _, err = io.ReadFull(b.rand, salt); err != nil {
+		b.log.Error("bootstrap generation failed", slog.Any("err", err))
+		return "", "", time.Time{}, err
+	}
 
-	derived := argon2.IDKey(sum[:], salt, 1, 64*1024, 4, 32)
-	hash = hex.EncodeToString(salt) + colonString + hex.EncodeToString(derived)
-	expires = time.Now().UTC().Add(24 * time.Hour)
+	hash = newArgonHash(sum[:], salt, b.params, bootstrapKeyLen).String()
+	expires = b.now().UTC().Add(b.ttl)
+	b.log.Info("bootstrap generated", slog.Time("expires", expires), slog.Any("params", b.params), slog.Any("claims", claims))
 	return
 }
 
@@ -62,48 +156,161 @@ func GenerateBootstrap() (plain, hash string, expires time.Time, err error) {
 //
 //   - plain must be the 64-character hex string previously returned from
 //     GenerateBootstrap.
-//   - stored must have the format "<salt-hex><colonString><argon2id-hash-hex>"
-//     as produced by GenerateBootstrap and is assumed to have been stored
-//     in a TEXT/VARCHAR column.
+//   - stored must be a PHC-formatted hash as produced by GenerateBootstrap,
+//     or a legacy "<salt-hex><colonString><argon2id-hash-hex>" value, which
+//     is checked with the original parameters (time=1, memory=64*1024 KiB,
+//     threads=4). It is assumed to have been stored in a TEXT/VARCHAR column.
+//
+// Keyed hashes from an issuer configured with WithKeyring fail with an error
+// wrapping ErrPepperRequired; validate them with that issuer's Validate.
+// ValidateBootstrap does not know when the secret expires; use
+// BootstrapIssuer.Validate to have expiry checked as well. Neither prevents
+// replay: use BootstrapIssuer.Issue and Redeem to have each token accepted
+// only once.
+//
+// Secrets bound to claims by GenerateBootstrapFor never validate here; use
+// ValidateBootstrapFor.
 func ValidateBootstrap(plain, stored string) (bool, error) {
+	return ValidateBootstrapFor(plain, stored, BootstrapClaims{})
+}
+
+// ValidateBootstrapFor behaves like ValidateBootstrap but only succeeds when
+// claims match those the secret was generated for. A mismatch is reported
+// like a wrong secret, so it does not reveal which claim differed.
+func ValidateBootstrapFor(plain, stored string, claims BootstrapClaims) (bool, error) {
+	return verifyBootstrap(plain, stored, claims, nil)
+}
+
+// verifyBootstrap implements ValidateBootstrapFor. Keyed hashes are checked
+// with kr, which may be nil.
+func verifyBootstrap(plain, stored string, claims BootstrapClaims, kr *Keyring) (bool, error) {
 	if plain == emptyString || stored == emptyString {
-		return false, errors.New("empty plain or stored value")
+		return false, bootstrapError(ErrEmpty, "", "empty plain or stored value")
+	}
+
+	var h argonHash
+	var err error
+	switch {
+	case !strings.HasPrefix(stored, digestMarker):
+		h, err = parseLegacyBootstrapHash(stored)
+	case strings.HasPrefix(stored, argonPHCPrefix):
+		h, err = parseArgonHash(stored, bootstrapError)
+	default:
+		return verifyBootstrapHMAC(plain, stored, claims, kr)
+	}
+	if err != nil {
+		return false, err
 	}
 
+	// Decode the hex-encoded plaintext secret back to raw bytes so we hash
+	// the same value that GenerateBootstrap used.
+	secretBytes, err := hex.DecodeString(plain)
+	if err != nil {
+		return false, bootstrapError(ErrMalformed, "token", "invalid plaintext encoding")
+	}
+	sum := bootstrapArgonInput(secretBytes, claims)
+
+	return h.matches(sum[:]), nil
+}
+
+// bootstrapArgonInput returns the value Argon2id derives the stored hash
+// from: sha256(secret), or sha256(secret || claims digest) for bound claims.
+func bootstrapArgonInput(secret []byte, claims BootstrapClaims) [sha256.Size]byte {
+	return sha256.Sum256(append(slices.Clip(secret), claims.digest()...))
+}
+
+// bootstrapHMACInput returns the message keyed bootstrap digests cover:
+// bootstrapDomain, the raw secret and, for bound claims, the claims digest.
+// The domain keeps a bootstrap digest from ever matching the digest of an
+// API key secret computed with the same keyring.
+func bootstrapHMACInput(secret []byte, claims BootstrapClaims) []byte {
+	b := append([]byte(bootstrapDomain), secret...)
+	return append(b, claims.digest()...)
+}
+
+// verifyBootstrapHMAC checks plain against a keyed digest stored by an
+// issuer configured with WithKeyring.
+func verifyBootstrapHMAC(plain, stored string, claims BootstrapClaims, kr *Keyring) (bool, error) {
+	d, err := parseDigest(stored)
+	if err != nil {
+		return false, asBootstrapError(err)
+	}
+	if !d.alg.keyed() {
+		return false, bootstrapError(ErrUnsupportedHash, "hash", "unsupported hash format")
+	}
+	if kr == nil {
+		return false, bootstrapError(ErrPepperRequired, "hash", "keyed hash needs a keyring")
+	}
+	secretBytes, err := hex.DecodeString(plain)
+	if err != nil {
+		return false, bootstrapError(ErrMalformed, "token", "invalid plaintext encoding")
+	}
+	ok, err := kr.verifyBootstrapDigest(bootstrapHMACInput(secretBytes, claims), d)
+	if err != nil {
+		return false, asBootstrapError(err)
+	}
+	return ok, nil
+}
+
+// asBootstrapError relabels an *Error raised by the API key digest code as a
+// bootstrap failure.
+func asBootstrapError(err error) error {
+	var e *Error
+	if !errors.As(err, &e) || e.Credential == CredentialBootstrap {
+		return err
+	}
+	relabeled := *e
+	relabeled.Credential = CredentialBootstrap
+	return &relabeled
+}
+
+// parseLegacyBootstrapHash decodes a "<salt-hex>:<hash-hex>" value written
+// before bootstrap hashes carried their parameters.
+func parseLegacyBootstrapHash(stored string) (argonHash, error) {
 	parts := strings.Split(stored, colonString)
 	if len(parts) != 2 {
-		return false, errors.New("invalid stored bootstrap hash format")
+		return argonHash{}, bootstrapError(ErrMalformedHash, "hash", "invalid stored bootstrap hash format")
 	}
 
 	saltHex, derivedHex := parts[0], parts[1]
 
 	salt, err := hex.DecodeString(saltHex)
 	if err != nil {
-		return false, errors.New("invalid salt encoding")
+		return argonHash{}, bootstrapError(ErrMalformedHash, "salt", "invalid salt encoding")
 	}
 	storedDerived, err := hex.DecodeString(derivedHex)
 	if err != nil {
-		return false, errors.New("invalid hash encoding")
+		return argonHash{}, bootstrapError(ErrMalformedHash, "hash", "invalid hash encoding")
 	}
-
-	// Decode the hex-encoded plaintext secret back to raw bytes so we hash
-	// the same value that GenerateBootstrap used.
-	secretBytes, err := hex.DecodeString(plain)
-	if err != nil {
-		return false, errors.New("invalid plaintext encoding")
+	if len(storedDerived) < minArgonSumLen {
+		return argonHash{}, bootstrapError(ErrMalformedHash, "hash", "derived key too short")
 	}
-	sum := sha256.Sum256(secretBytes)
+	return argonHash{argonParams: bootstrapArgonParams, salt: salt, sum: storedDerived}, nil
+}
 
-	// Argon2ID params must match GenerateBootstrap exactly.
-	computed := argon2.IDKey(sum[:], salt, 1, 64*1024, 4, 32)
+// Validate behaves like ValidateBootstrap and additionally fails with an
+// error wrapping ErrExpired when the secret matches but b's clock is at or
+// past expires, the value returned by Generate. A zero expires skips the
+// check. Expiry is only reported once the secret has matched. Keyed hashes
+// are checked with the keyring given to WithKeyring.
+func (b *BootstrapIssuer) Validate(plain, stored string, expires time.Time) (bool, error) {
+	return b.ValidateFor(plain, stored, expires, BootstrapClaims{})
+}
 
-	// Constant-time comparison.
-	if len(computed) != len(storedDerived) {
-		return false, nil
+// ValidateFor behaves like Validate but only succeeds when claims match
+// those the secret was generated for, as ValidateBootstrapFor does.
+func (b *BootstrapIssuer) ValidateFor(plain, stored string, expires time.Time, claims BootstrapClaims) (bool, error) {
+	ok, err := verifyBootstrap(plain, stored, claims, b.keyring)
+	if err == nil && ok && !expires.IsZero() && !b.now().Before(expires) {
+		ok, err = false, bootstrapError(ErrExpired, "", "token expired")
 	}
-	if subtle.ConstantTimeCompare(computed, storedDerived) != 1 {
-		return false, nil
+	switch {
+	case err != nil:
+		b.log.Info("bootstrap rejected", slog.Any("err", err))
+	case !ok:
+		b.log.Info("bootstrap rejected", slog.Any("err", ErrMismatch))
+	default:
+		b.log.Info("bootstrap validated")
 	}
-
-	return true, nil
+	return ok, err
 }
@@ -1,9 +1,14 @@
 package apikey
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/argon2"
 )
 
 func TestGenerateBootstrapAndValidate_Success(t *testing.T) {
@@ -20,8 +25,8 @@ func TestGenerateBootstrapAndValidate_Success(t *testing.T) {
 	if !isTextSafe(plain) || !isTextSafe(stored) {
 		t.Fatalf("bootstrap outputs are not text-safe")
 	}
-	if !strings.Contains(stored, colonString) {
-		t.Fatalf("stored hash %q missing separator %q", stored, colonString)
+	if !strings.HasPrefix(stored, "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Fatalf("stored hash %q does not carry its parameters", stored)
 	}
 	if time.Until(expires) <= 0 {
 		t.Fatalf("expected expiry in the future, got %v", expires)
@@ -61,3 +66,163 @@ func TestValidateBootstrap_WrongSecret(t *testing.T) {
 		t.Fatalf("expected validation to fail for wrong secret")
 	}
 }
+
+func TestBootstrapIssuer_ClockAndTTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	clock := func() time.Time { return now }
+	b := NewBootstrapIssuer(WithClock(clock), WithTTL(15*time.Minute))
+
+	plain, stored, expires, err := b.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if want := now.UTC().Add(15 * time.Minute); !expires.Equal(want) || expires.Location() != time.UTC {
+		t.Fatalf("expires = %v, want %v in UTC", expires, want)
+	}
+
+	if ok, err := b.Validate(plain, stored, expires); err != nil || !ok {
+		t.Fatalf("Validate before expiry ok=%v err=%v", ok, err)
+	}
+	now = now.Add(15 * time.Minute)
+	if ok, err := b.Validate(plain, stored, expires); !errors.Is(err, ErrExpired) || ok {
+		t.Fatalf("Validate at expiry ok=%v err=%v, want ErrExpired", ok, err)
+	}
+	if ok, err := b.Validate(plain, stored, time.Time{}); err != nil || !ok {
+		t.Fatalf("Validate without expiry ok=%v err=%v", ok, err)
+	}
+	// a wrong secret is reported as a mismatch, not as expired
+	wrong := plain[:63] + "0"
+	if plain[63] == '0' {
+		wrong = plain[:63] + "1"
+	}
+	if ok, err := b.Validate(wrong, stored, expires); err != nil || ok {
+		t.Fatalf("Validate with wrong secret ok=%v err=%v", ok, err)
+	}
+}
+
+func TestBootstrapIssuer_DefaultTTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, _, expires, err := NewBootstrapIssuer(WithClock(func() time.Time { return now }), WithTTL(0)).Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if !expires.Equal(now.Add(DefaultBootstrapTTL)) {
+		t.Fatalf("expires = %v, want default TTL", expires)
+	}
+}
+
+func TestValidateBootstrap_LegacyFormat(t *testing.T) {
+	secret := make([]byte, 32)
+	salt := []byte("0123456789abcdef")
+	sum := sha256.Sum256(secret)
+	stored := hex.EncodeToString(salt) + colonString + hex.EncodeToString(argon2.IDKey(sum[:], salt, 1, 64*1024, 4, 32))
+	plain := hex.EncodeToString(secret)
+
+	if ok, err := ValidateBootstrap(plain, stored); err != nil || !ok {
+		t.Fatalf("legacy hash should validate, ok=%v err=%v", ok, err)
+	}
+	if ok, err := ValidateBootstrap(strings.Repeat("11", 32), stored); err != nil || ok {
+		t.Fatalf("legacy hash with wrong secret ok=%v err=%v", ok, err)
+	}
+}
+
+func TestBootstrapIssuer_Argon2Params(t *testing.T) {
+	plain, stored, _, err := NewBootstrapIssuer(WithArgon2Params(2, 8*1024, 1)).Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if !strings.HasPrefix(stored, "$argon2id$v=19$m=8192,t=2,p=1$") {
+		t.Fatalf("stored hash %q does not carry the tuned parameters", stored)
+	}
+	// parameters come from the stored value, not the validating issuer
+	if ok, err := ValidateBootstrap(plain, stored); err != nil || !ok {
+		t.Fatalf("ValidateBootstrap ok=%v err=%v", ok, err)
+	}
+
+	_, stored, _, _ = NewBootstrapIssuer(WithArgon2Params(0, 0, 2)).Generate()
+	if !strings.HasPrefix(stored, "$argon2id$v=19$m=65536,t=1,p=2$") {
+		t.Fatalf("zero parameters should keep the defaults, got %q", stored)
+	}
+}
+
+func TestValidateBootstrap_MalformedPHC(t *testing.T) {
+	plain := strings.Repeat("00", 32)
+	salt := "MDEyMzQ1Njc4OWFiY2RlZg"
+	sum := "62H3i98IL4WzDNHdN5hU3hHIvBKOGrqg54L0fTWW8+w"
+	for _, stored := range []string{
+		"$argon2i$v=19$m=65536,t=1,p=4$" + salt + "$" + sum,
+		"$argon2id$v=16$m=65536,t=1,p=4$" + salt + "$" + sum,
+		"$argon2id$v=19$m=65536,t=0,p=4$" + salt + "$" + sum,
+		"$argon2id$v=19$m=65536,t=1$" + salt + "$" + sum,
+		"$argon2id$v=19$m=65536,t=1,p=4,x=1$" + salt + "$" + sum,
+		"$argon2id$v=19$m=65536,t=1,p=4$$" + sum,
+		"$argon2id$v=19$m=65536,t=1,p=4$" + salt + "$",
+		"$argon2id$v=19$m=65536,t=1,p=4$" + salt,
+		hex.EncodeToString([]byte("salt")) + colonString,
+	} {
+		if ok, err := ValidateBootstrap(plain, stored); err == nil || ok {
+			t.Fatalf("expected error for %q, got ok=%v err=%v", stored, ok, err)
+		}
+	}
+}
+
+func TestBootstrapIssuer_Keyring(t *testing.T) {
+	kr, _ := NewKeyring(DigestHMACSHA256)
+	_ = kr.Add("b1", testPepper)
+	_ = kr.SetCurrent("b1")
+	b := NewBootstrapIssuer(WithKeyring(kr))
+
+	plain, stored, expires, err := b.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if !strings.HasPrefix(stored, "$hmac-sha256$v=2$k=b1$") {
+		t.Fatalf("stored hash %q is not a keyed digest", stored)
+	}
+	if ok, err := b.Validate(plain, stored, expires); err != nil || !ok {
+		t.Fatalf("Validate ok=%v err=%v", ok, err)
+	}
+	if ok, err := b.Validate(strings.ToUpper(plain), stored, expires); err != nil || !ok {
+		t.Fatalf("Validate should accept upper-case hex, ok=%v err=%v", ok, err)
+	}
+	if ok, err := b.Validate(strings.Repeat("11", 32), stored, expires); err != nil || ok {
+		t.Fatalf("Validate with wrong secret ok=%v err=%v", ok, err)
+	}
+	if ok, err := b.Validate("zz", stored, expires); !errors.Is(err, ErrMalformed) || ok {
+		t.Fatalf("Validate with bad encoding ok=%v err=%v", ok, err)
+	}
+
+	// a bootstrap hash is never the digest of an API key, not even of a
+	// legacy key whose secret is the same hex string
+	if _, err := ParseKey("abcd1234." + plain); err != nil {
+		t.Fatalf("ParseKey error: %v", err)
+	}
+	if ok, _, err := kr.ValidateApiKey("abcd1234."+plain, stored); err != nil || ok {
+		t.Fatalf("bootstrap hash validated as an API key digest, ok=%v err=%v", ok, err)
+	}
+
+	// keyed hashes need the keyring
+	_, err = ValidateBootstrap(plain, stored)
+	var e *Error
+	if !errors.Is(err, ErrPepperRequired) || !errors.As(err, &e) || e.Credential != CredentialBootstrap {
+		t.Fatalf("ValidateBootstrap err=%v, want bootstrap ErrPepperRequired", err)
+	}
+
+	// an issuer with a keyring still accepts Argon2id hashes
+	plain, stored, _, _ = GenerateBootstrap()
+	if ok, err := b.Validate(plain, stored, time.Time{}); err != nil || !ok {
+		t.Fatalf("Validate of Argon2id hash ok=%v err=%v", ok, err)
+	}
+
+	if _, err := b.Validate(plain, "$sha512$v=2$"+strings.Repeat("0", 128), time.Time{}); !errors.Is(err, ErrUnsupportedHash) {
+		t.Fatalf("unkeyed digests must be refused, got %v", err)
+	}
+	if _, err := b.Validate(plain, "$hmac-sha256$v=2$k=zz$"+strings.Repeat("0", 64), time.Time{}); !errors.Is(err, ErrUnknownPepper) {
+		t.Fatalf("expected ErrUnknownPepper, got %v", err)
+	}
+
+	empty, _ := NewKeyring(DigestHMACSHA256)
+	if _, _, _, err := NewBootstrapIssuer(WithKeyring(empty)).Generate(); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("Generate without current pepper err=%v", err)
+	}
+}
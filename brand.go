@@ -0,0 +1,150 @@
+package apikey
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// DefaultVendorTag is the vendor tag used by GenerateBrandedApiKey when no
+// tag is given.
+const DefaultVendorTag = "smk"
+
+// Vendor tag length bounds.
+const (
+	minVendorLen = 2
+	maxVendorLen = 8
+)
+
+// secretSymbolClass is userFriendlyAlphabet as a regular expression class.
+const secretSymbolClass = `[A-HJKMNP-Z2-9]`
+
+// BrandedKeyPattern matches keys generated by GenerateBrandedApiKey and
+// GenerateApiKeyKind with DefaultVendorTag. It is suitable for registering
+// with secret scanners such as GitHub secret scanning or gitleaks; use
+// BrandedKeyRegexp for other vendor tags. Matches should be confirmed with
+// ParseApiKey, which verifies the checksum.
+var BrandedKeyPattern = regexp.MustCompile(brandedKeyExpr(DefaultVendorTag))
+
+// BrandedKeyRegexp returns the pattern matching branded keys carrying vendor.
+func BrandedKeyRegexp(vendor string) (*regexp.Regexp, error) {
+	if !isValidVendor(vendor) {
+		return nil, keyError(ErrInvalidArgument, "vendor", "invalid vendor tag")
+	}
+	return regexp.Compile(brandedKeyExpr(vendor))
+}
+
+// brandedKeyExpr builds the expression behind BrandedKeyPattern. vendor must
+// already be validated; it only contains lowercase letters.
+func brandedKeyExpr(vendor string) string {
+	return fmt.Sprintf(`\b%s%s(?:(?:%s|%s|%s|%s)%s)?[0-9a-f]{1,%d}%s%s(?:-?%s){%d}%s%s{%d}\b`,
+		vendor, separator,
+		KindLive, KindTest, KindService, KindReadOnly, separator,
+		MaxPrefixLen, separator,
+		secretSymbolClass, secretSymbolClass, SecretSymbolLen-1, separator,
+		secretSymbolClass, ChecksumLen)
+}
+
+// GenerateBrandedApiKey creates a new API key in the scanner-friendly
+// branded format:
+//
+//	<vendor>_<prefix>_<secret>_<checksum>
+//
+// vendor defaults to DefaultVendorTag when empty. Otherwise it must be 2 to 8
+// lowercase ASCII letters including at least one outside a-f, so it can never
+// be mistaken for a hex prefix. The checksum covers the vendor, prefix and
+// secret. prefix and hash have the same meaning as for GenerateApiKey.
+func GenerateBrandedApiKey(vendor string, prefixLen int) (fullKey, prefix, hash string, err error) {
+	if vendor == "" {
+		vendor = DefaultVendorTag
+	}
+	if !isValidVendor(vendor) {
+		return "", "", "", keyError(ErrInvalidArgument, "vendor", "invalid vendor tag")
+	}
+	k, err := GenerateKey(KeySpec{PrefixLen: prefixLen, Vendor: vendor})
+	if err != nil {
+		return "", "", "", err
+	}
+	return k.String(), k.Prefix(), k.Digest(), nil
+}
+
+// Finding is a branded API key found by a Detector.
+type Finding struct {
+	// Line is the 1-based line number the key was found on.
+	Line int
+	// Key is the full key as it appeared in the input. It is sensitive.
+	Key string
+}
+
+// Detector finds branded API keys in arbitrary text such as log files.
+// Candidates are matched against the vendor's pattern and then confirmed by
+// verifying their checksum, so false positives are rare.
+type Detector struct {
+	re *regexp.Regexp
+}
+
+// NewDetector returns a Detector for keys branded with vendor, or with
+// DefaultVendorTag when vendor is empty.
+func NewDetector(vendor string) (*Detector, error) {
+	if vendor == "" {
+		return &Detector{re: BrandedKeyPattern}, nil
+	}
+	re, err := BrandedKeyRegexp(vendor)
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{re: re}, nil
+}
+
+// Find returns every checksum-valid branded key in text, in order of
+// appearance.
+func (d *Detector) Find(text string) []string {
+	var keys []string
+	for _, m := range d.re.FindAllString(text, -1) {
+		if _, err := ParseKey(m); err == nil {
+			keys = append(keys, m)
+		}
+	}
+	return keys
+}
+
+// Scan reads r line by line and returns every checksum-valid branded key.
+func (d *Detector) Scan(r io.Reader) ([]Finding, error) {
+	var findings []Finding
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		for _, k := range d.Find(sc.Text()) {
+			findings = append(findings, Finding{Line: line, Key: k})
+		}
+	}
+	return findings, sc.Err()
+}
+
+// FindApiKeys returns every checksum-valid key branded with
+// DefaultVendorTag in text.
+func FindApiKeys(text string) []string {
+	return (&Detector{re: BrandedKeyPattern}).Find(text)
+}
+
+// isValidVendor validates a vendor tag: 2 to 8 lowercase ASCII letters, at
+// least one of which is outside a-f.
+func isValidVendor(v string) bool {
+	if len(v) < minVendorLen || len(v) > maxVendorLen {
+		return false
+	}
+	nonHex := false
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 'a' || c > 'z' {
+			return false
+		}
+		if c > 'f' {
+			nonHex = true
+		}
+	}
+	return nonHex
+}
@@ -0,0 +1,115 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBrandedAndValidate(t *testing.T) {
+	full, prefix, hash, err := GenerateBrandedApiKey("", 8)
+	if err != nil {
+		t.Fatalf("GenerateBrandedApiKey error: %v", err)
+	}
+	if !strings.HasPrefix(full, DefaultVendorTag+separator+prefix+separator) {
+		t.Fatalf("branded key %q does not start with vendor and prefix", full)
+	}
+	if !BrandedKeyPattern.MatchString(full) {
+		t.Fatalf("BrandedKeyPattern does not match %q", full)
+	}
+	p, _, err := ParseApiKey(full)
+	if err != nil {
+		t.Fatalf("ParseApiKey error: %v", err)
+	}
+	if p != prefix {
+		t.Fatalf("ParseApiKey prefix = %q, want %q", p, prefix)
+	}
+	ok, err := ValidateApiKey(full, hash)
+	if err != nil || !ok {
+		t.Fatalf("ValidateApiKey should succeed, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestGenerateBrandedApiKey_CustomVendor(t *testing.T) {
+	full, _, _, err := GenerateBrandedApiKey("stnmgr", 6)
+	if err != nil {
+		t.Fatalf("GenerateBrandedApiKey error: %v", err)
+	}
+	re, err := BrandedKeyRegexp("stnmgr")
+	if err != nil {
+		t.Fatalf("BrandedKeyRegexp error: %v", err)
+	}
+	if !re.MatchString(full) {
+		t.Fatalf("custom pattern does not match %q", full)
+	}
+	if BrandedKeyPattern.MatchString(full) {
+		t.Fatalf("default pattern should not match a custom vendor key")
+	}
+	if _, _, err := ParseApiKey(full); err != nil {
+		t.Fatalf("ParseApiKey error: %v", err)
+	}
+}
+
+func TestGenerateBrandedApiKey_InvalidVendor(t *testing.T) {
+	for _, v := range []string{"x", "abc", "SMK", "sm_k", "toolongvendor", "sm1"} {
+		if _, _, _, err := GenerateBrandedApiKey(v, 8); err == nil {
+			t.Fatalf("expected error for vendor %q", v)
+		}
+		if _, err := BrandedKeyRegexp(v); err == nil {
+			t.Fatalf("expected BrandedKeyRegexp error for vendor %q", v)
+		}
+	}
+}
+
+func TestParseApiKey_BrandedChecksum(t *testing.T) {
+	full, _, _, err := GenerateBrandedApiKey("", 8)
+	if err != nil {
+		t.Fatalf("GenerateBrandedApiKey error: %v", err)
+	}
+	// swapping the vendor invalidates the checksum, which covers it
+	swapped := "xyz" + strings.TrimPrefix(full, DefaultVendorTag)
+	if _, _, err := ParseApiKey(swapped); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch for swapped vendor, got %v", err)
+	}
+}
+
+func TestDetectorFindAndScan(t *testing.T) {
+	k1, _, _, err := GenerateBrandedApiKey("", 8)
+	if err != nil {
+		t.Fatalf("GenerateBrandedApiKey error: %v", err)
+	}
+	k2, _, _, err := GenerateBrandedApiKey("", 12)
+	if err != nil {
+		t.Fatalf("GenerateBrandedApiKey error: %v", err)
+	}
+	// same shape as a real key but with a broken checksum
+	fake := k2[:len(k2)-1] + "A"
+	if fake == k2 {
+		fake = k2[:len(k2)-1] + "B"
+	}
+	log := "level=info msg=\"upload\" auth=" + k1 + "\n" +
+		"nothing to see here\n" +
+		"key: " + fake + "\n" +
+		"Authorization: ApiKey " + k2 + " trailing\n"
+
+	got := FindApiKeys(log)
+	if len(got) != 2 || got[0] != k1 || got[1] != k2 {
+		t.Fatalf("FindApiKeys = %v, want [%s %s]", got, k1, k2)
+	}
+
+	d, err := NewDetector("")
+	if err != nil {
+		t.Fatalf("NewDetector error: %v", err)
+	}
+	findings, err := d.Scan(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("Scan error: %v", err)
+	}
+	if len(findings) != 2 || findings[0].Line != 1 || findings[1].Line != 4 {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+
+	if _, err := NewDetector("abc"); err == nil {
+		t.Fatalf("expected error for invalid vendor")
+	}
+}
@@ -0,0 +1,46 @@
+package apikey
+
+import (
+	"hash/crc32"
+	"strings"
+)
+
+// ChecksumLen is the number of symbols in the optional checksum segment of a
+// full API key.
+const ChecksumLen = 6
+
+// keyChecksum computes the checksum segment for k: the CRC-32 (IEEE) of the
+// key body with the secret's dashes removed (e.g. "<prefix>_<secret>"),
+// written as ChecksumLen digits in alphabet, which is userFriendlyAlphabet
+// unless a Generator uses another one. 31^6 covers just over 2^29 values, so
+// the top bits of the CRC are folded away; that is plenty for catching typos
+// and keeps the segment short enough to retype.
+//
+// The checksum is not a secret and provides no authentication; it only lets
+// us (and secret scanners) reject strings that cannot be valid keys without
+// touching storage.
+func keyChecksum(k Key, alphabet string) string {
+	k.secret = canonicalSecret(k.secret)
+	crc := crc32.ChecksumIEEE([]byte(k.body()))
+	base := uint32(len(alphabet))
+	var b [ChecksumLen]byte
+	for i := ChecksumLen - 1; i >= 0; i-- {
+		b[i] = alphabet[crc%base]
+		crc /= base
+	}
+	return string(b[:])
+}
+
+// isValidChecksum validates the shape of a checksum segment: exactly
+// ChecksumLen characters from alphabet.
+func isValidChecksum(s, alphabet string) bool {
+	if len(s) != ChecksumLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(alphabet, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateWithChecksumAndValidate(t *testing.T) {
+	full, prefix, hash, err := GenerateApiKeyWithChecksum(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyWithChecksum error: %v", err)
+	}
+	if !isTextSafe(full) {
+		t.Fatalf("generated key is not text-safe")
+	}
+	segs := strings.Split(full, separator)
+	if len(segs) != 3 || segs[0] != prefix || len(segs[2]) != ChecksumLen {
+		t.Fatalf("unexpected key layout: %q", full)
+	}
+	p, secret, err := ParseApiKey(full)
+	if err != nil {
+		t.Fatalf("ParseApiKey error: %v", err)
+	}
+	if p != prefix || secret != segs[1] {
+		t.Fatalf("ParseApiKey returned %q/%q, want %q/%q", p, secret, prefix, segs[1])
+	}
+	ok, err := ValidateApiKey(full, hash)
+	if err != nil || !ok {
+		t.Fatalf("ValidateApiKey should succeed, ok=%v err=%v", ok, err)
+	}
+	// The digest covers the secret only, so the key also validates without
+	// its checksum segment.
+	ok, err = ValidateApiKey(prefix+separator+secret, hash)
+	if err != nil || !ok {
+		t.Fatalf("ValidateApiKey without checksum should succeed, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestParseApiKey_ChecksumDetectsTypos(t *testing.T) {
+	full, _, _, err := GenerateApiKeyWithChecksum(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyWithChecksum error: %v", err)
+	}
+	secretStart := strings.Index(full, separator) + 1
+	for i := secretStart; i < len(full); i++ {
+		if full[i] == '-' || full[i] == '_' {
+			continue
+		}
+		// substitute one symbol with its neighbour in the alphabet
+		idx := strings.IndexByte(userFriendlyAlphabet, full[i])
+		repl := userFriendlyAlphabet[(idx+1)%len(userFriendlyAlphabet)]
+		typo := full[:i] + string(repl) + full[i+1:]
+		if _, _, err := ParseApiKey(typo); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("expected ErrChecksumMismatch for typo at %d (%q), got %v", i, typo, err)
+		}
+	}
+}
+
+func TestParseApiKey_InvalidChecksumShape(t *testing.T) {
+	full, _, _, err := GenerateApiKeyWithChecksum(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyWithChecksum error: %v", err)
+	}
+	for _, bad := range []string{full + "A", full[:len(full)-1], full + separator + "ABCDEF"} {
+		if _, _, err := ParseApiKey(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestKeyChecksum_Deterministic(t *testing.T) {
+	a := keyChecksum(Key{sep: separator, prefix: "abcd12", secret: "ABCD-EFGH-JKMN-PQRS-TUVW"}, userFriendlyAlphabet)
+	b := keyChecksum(Key{sep: separator, prefix: "abcd12", secret: "ABCDEFGHJKMNPQRSTUVW"}, userFriendlyAlphabet)
+	if a != b {
+		t.Fatalf("checksum should ignore dash grouping: %q != %q", a, b)
+	}
+	if !isValidChecksum(a, userFriendlyAlphabet) {
+		t.Fatalf("checksum %q has invalid shape", a)
+	}
+}
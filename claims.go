@@ -0,0 +1,66 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"log/slog"
+	"strings"
+)
+
+// claimsDomain separates the claims encoding from any other SHA-256 input.
+const claimsDomain = "apikey/bootstrap-claims/v1"
+
+// BootstrapClaims bind a bootstrap token to the context it was issued for.
+// Bound claims are folded into the stored hash, so a token only validates
+// when the same claims are presented again; a leaked token is useless for
+// another account, logbook, station or action. The claims themselves are
+// not stored and are not secret.
+//
+// The zero value binds nothing: tokens generated without claims validate
+// only without claims, exactly as before claims existed.
+type BootstrapClaims struct {
+	// AccountID is the account the token provisions.
+	AccountID string
+	// LogbookUID is the logbook the token provisions.
+	LogbookUID string
+	// Callsign is the station the token was issued to. It is compared
+	// case-insensitively and without surrounding whitespace.
+	Callsign string
+	// Action is what the token may be used for, e.g. "register-desktop".
+	Action string
+}
+
+// IsZero reports whether c binds nothing.
+func (c BootstrapClaims) IsZero() bool { return c.canonical() == BootstrapClaims{} }
+
+// LogValue implements slog.LogValuer.
+func (c BootstrapClaims) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("account", c.AccountID),
+		slog.String("logbook", c.LogbookUID),
+		slog.String("callsign", c.canonical().Callsign),
+		slog.String("action", c.Action),
+	)
+}
+
+// canonical returns c with Callsign normalised.
+func (c BootstrapClaims) canonical() BootstrapClaims {
+	c.Callsign = strings.ToUpper(strings.TrimSpace(c.Callsign))
+	return c
+}
+
+// digest returns the SHA-256 of the canonical claims, each field prefixed
+// with its length, or nil for zero claims.
+func (c BootstrapClaims) digest() []byte {
+	c = c.canonical()
+	if c == (BootstrapClaims{}) {
+		return nil
+	}
+	b := []byte(claimsDomain)
+	for _, f := range []string{c.AccountID, c.LogbookUID, c.Callsign, c.Action} {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
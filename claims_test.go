@@ -0,0 +1,112 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+var testClaims = BootstrapClaims{AccountID: "acct-1", LogbookUID: "lb-1", Callsign: "M0ABC", Action: "register-desktop"}
+
+func TestBootstrapClaims_Bound(t *testing.T) {
+	kr, _ := NewKeyring(DigestHMACSHA256)
+	_ = kr.Add("b1", testPepper)
+	_ = kr.SetCurrent("b1")
+
+	for _, b := range []*BootstrapIssuer{NewBootstrapIssuer(cheapArgon), NewBootstrapIssuer(WithKeyring(kr))} {
+		plain, stored, expires, err := b.GenerateFor(testClaims)
+		if err != nil {
+			t.Fatalf("GenerateFor error: %v", err)
+		}
+		if ok, err := b.ValidateFor(plain, stored, expires, testClaims); err != nil || !ok {
+			t.Fatalf("ValidateFor with matching claims ok=%v err=%v", ok, err)
+		}
+		relaxed := testClaims
+		relaxed.Callsign = " m0abc "
+		if ok, err := b.ValidateFor(plain, stored, expires, relaxed); err != nil || !ok {
+			t.Fatalf("callsigns should match case-insensitively, ok=%v err=%v", ok, err)
+		}
+
+		wrong := []BootstrapClaims{{}}
+		for i := range 4 {
+			c := testClaims
+			switch i {
+			case 0:
+				c.AccountID = "acct-2"
+			case 1:
+				c.LogbookUID = "lb-2"
+			case 2:
+				c.Callsign = "M0ABD"
+			case 3:
+				c.Action = "rotate-key"
+			}
+			wrong = append(wrong, c)
+		}
+		for _, c := range wrong {
+			if ok, err := b.ValidateFor(plain, stored, expires, c); err != nil || ok {
+				t.Fatalf("ValidateFor with claims %+v ok=%v err=%v", c, ok, err)
+			}
+		}
+		if ok, err := b.Validate(plain, stored, expires); err != nil || ok {
+			t.Fatalf("a bound token must not validate without claims, ok=%v err=%v", ok, err)
+		}
+	}
+}
+
+func TestBootstrapClaims_Unbound(t *testing.T) {
+	plain, stored, _, err := GenerateBootstrap()
+	if err != nil {
+		t.Fatalf("GenerateBootstrap error: %v", err)
+	}
+	if ok, err := ValidateBootstrapFor(plain, stored, BootstrapClaims{Callsign: "  "}); err != nil || !ok {
+		t.Fatalf("blank claims bind nothing, ok=%v err=%v", ok, err)
+	}
+	if ok, err := ValidateBootstrapFor(plain, stored, testClaims); err != nil || ok {
+		t.Fatalf("an unbound token must not validate with claims, ok=%v err=%v", ok, err)
+	}
+
+	plain, stored, _, err = GenerateBootstrapFor(testClaims)
+	if err != nil {
+		t.Fatalf("GenerateBootstrapFor error: %v", err)
+	}
+	if ok, err := ValidateBootstrapFor(plain, stored, testClaims); err != nil || !ok {
+		t.Fatalf("ValidateBootstrapFor ok=%v err=%v", ok, err)
+	}
+}
+
+func TestBootstrapClaims_DigestUnambiguous(t *testing.T) {
+	a := BootstrapClaims{AccountID: "ab", LogbookUID: "c"}
+	b := BootstrapClaims{AccountID: "a", LogbookUID: "bc"}
+	if bytes.Equal(a.digest(), b.digest()) {
+		t.Fatalf("field boundaries must be part of the digest")
+	}
+	if (BootstrapClaims{}).digest() != nil || !(BootstrapClaims{Callsign: " "}).IsZero() {
+		t.Fatalf("zero claims must not change the hash input")
+	}
+}
+
+func TestRedeem_Claims(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	b := NewBootstrapIssuer(cheapArgon)
+
+	if _, _, err := b.Issue(ctx, store, "acct-1", "lb-2", testClaims); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument for a conflicting logbook, got %v", err)
+	}
+	plain, rec, err := b.Issue(ctx, store, "acct-1", testClaims.LogbookUID, testClaims)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if rec.LogbookUID != testClaims.LogbookUID {
+		t.Fatalf("LogbookUID = %q, want %q", rec.LogbookUID, testClaims.LogbookUID)
+	}
+	other := testClaims
+	other.Action = "rotate-key"
+	if _, _, err := b.Exchange(ctx, store, "acct-1", plain, other); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch for wrong claims, got %v", err)
+	}
+	if _, _, err := b.Exchange(ctx, store, "acct-1", plain, testClaims); err != nil {
+		t.Fatalf("Exchange with matching claims error: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// DigestAlgorithm identifies how a stored API key digest was computed.
+type DigestAlgorithm string
+
+const (
+	// DigestSHA512 is the unkeyed SHA-512 digest produced by HashApiKeySecret.
+	// Version 1 digests are stored as bare lowercase hex.
+	DigestSHA512 DigestAlgorithm = "sha512"
+	// DigestHMACSHA256 is HMAC-SHA-256 keyed with a server-held pepper.
+	DigestHMACSHA256 DigestAlgorithm = "hmac-sha256"
+	// DigestHMACSHA512 is HMAC-SHA-512 keyed with a server-held pepper.
+	DigestHMACSHA512 DigestAlgorithm = "hmac-sha512"
+)
+
+// MinPepperLen is the minimum pepper length, in bytes, accepted for keyed
+// digests.
+const MinPepperLen = 16
+
+// digestMarker starts every self-describing digest. Bare hex digests (the
+// original HashApiKeySecret output) never contain it.
+const digestMarker = "$"
+
+// Digest versions. Version 1 digests were computed over the secret exactly as
+// given, dashes included; version 2 digests are computed over the canonical
+// secret with its dashes removed, so that regrouping a key never changes its
+// digest. Version 1 is implied by digests without a "v=" parameter.
+const (
+	digestV1 = 1
+	digestV2 = 2
+
+	// currentDigestVersion is the version of newly computed digests.
+	currentDigestVersion = digestV2
+)
+
+// keyed reports whether the algorithm requires a pepper.
+func (a DigestAlgorithm) keyed() bool {
+	return a == DigestHMACSHA256 || a == DigestHMACSHA512
+}
+
+// newHash returns the hash constructor backing the algorithm, or nil when the
+// algorithm is unknown.
+func (a DigestAlgorithm) newHash() func() hash.Hash {
+	switch a {
+	case DigestSHA512, DigestHMACSHA512:
+		return sha512.New
+	case DigestHMACSHA256:
+		return sha256.New
+	}
+	return nil
+}
+
+// digest is the decoded form of a stored API key digest.
+type digest struct {
+	alg     DigestAlgorithm
+	version int
+	// pepperID names the Keyring pepper a keyed digest was computed with. It
+	// is empty for unkeyed digests and for keyed digests that predate the
+	// keyring.
+	pepperID string
+	sum      []byte
+}
+
+// parseDigest decodes a stored digest. These forms are accepted:
+//   - a bare 128-character hex string: the version 1 unkeyed SHA-512 digest
+//     originally returned by HashApiKeySecret.
+//   - "$<alg>$<hex>": a version 1 keyed digest, e.g. "$hmac-sha512$<hex>".
+//   - "$<alg>$k=<id>$<hex>": a version 1 keyed digest that also names the
+//     Keyring pepper it was computed with.
+//   - "$<alg>$v=2$<hex>" and "$<alg>$v=2$k=<id>$<hex>": the same for
+//     version 2 digests, which may also be unkeyed ("$sha512$v=2$<hex>").
+func parseDigest(stored string) (digest, error) {
+	if !strings.HasPrefix(stored, digestMarker) {
+		sum, err := hex.DecodeString(stored)
+		if err != nil || len(sum) != sha512.Size {
+			return digest{}, keyError(ErrMalformedHash, "digest", "invalid digest encoding")
+		}
+		return digest{alg: DigestSHA512, version: digestV1, sum: sum}, nil
+	}
+	parts := strings.Split(stored, digestMarker)
+	// parts: ["", "<alg>", ["v=<n>",] ["k=<id>",] "<hex>"]
+	if len(parts) < 3 || len(parts) > 5 {
+		return digest{}, keyError(ErrMalformedHash, "digest", "invalid digest format")
+	}
+	d := digest{alg: DigestAlgorithm(parts[1]), version: digestV1}
+	if d.alg.newHash() == nil {
+		return digest{}, keyError(ErrUnsupportedHash, "digest", "unsupported digest algorithm")
+	}
+	params := parts[2 : len(parts)-1]
+	if len(params) > 0 {
+		if v, ok := strings.CutPrefix(params[0], "v="); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < digestV1 {
+				return digest{}, keyError(ErrMalformedHash, "digest", "invalid digest version")
+			}
+			if n > currentDigestVersion {
+				return digest{}, keyError(ErrUnsupportedHash, "digest", "unsupported digest version")
+			}
+			d.version = n
+			params = params[1:]
+		}
+	}
+	if len(params) > 0 {
+		id, ok := strings.CutPrefix(params[0], "k=")
+		if !ok || !isValidPepperID(id) || len(params) > 1 {
+			return digest{}, keyError(ErrMalformedHash, "digest", "invalid digest params")
+		}
+		d.pepperID = id
+	}
+	// Version 1 unkeyed digests only exist as bare hex.
+	if !d.alg.keyed() && (d.version == digestV1 || d.pepperID != "") {
+		return digest{}, keyError(ErrMalformedHash, "digest", "invalid digest params")
+	}
+	sum, err := hex.DecodeString(parts[len(parts)-1])
+	if err != nil || len(sum) != d.alg.newHash()().Size() {
+		return digest{}, keyError(ErrMalformedHash, "digest", "invalid digest encoding")
+	}
+	d.sum = sum
+	return d, nil
+}
+
+// String encodes the digest in its storage form.
+func (d digest) String() string {
+	if d.alg == DigestSHA512 && d.version == digestV1 {
+		return hex.EncodeToString(d.sum)
+	}
+	var sb strings.Builder
+	sb.WriteString(digestMarker + string(d.alg) + digestMarker)
+	if d.version != digestV1 {
+		sb.WriteString("v=" + strconv.Itoa(d.version) + digestMarker)
+	}
+	if d.pepperID != "" {
+		sb.WriteString("k=" + d.pepperID + digestMarker)
+	}
+	sb.WriteString(hex.EncodeToString(d.sum))
+	return sb.String()
+}
+
+// computeDigest derives the digest of secret using alg and the given digest
+// version. pepper is required for keyed algorithms and ignored otherwise.
+func computeDigest(alg DigestAlgorithm, version int, secret string, pepper []byte) (digest, error) {
+	newHash := alg.newHash()
+	if newHash == nil {
+		return digest{}, keyError(ErrInvalidArgument, "digest", "unsupported digest algorithm")
+	}
+	if version >= digestV2 {
+		secret = canonicalSecret(secret)
+	}
+	if !alg.keyed() {
+		h := newHash()
+		h.Write([]byte(secret))
+		return digest{alg: alg, version: version, sum: h.Sum(nil)}, nil
+	}
+	sum, err := keyedSum(alg, pepper, []byte(secret))
+	if err != nil {
+		return digest{}, err
+	}
+	return digest{alg: alg, version: version, sum: sum}, nil
+}
+
+// keyedSum returns the HMAC of msg under pepper using the keyed algorithm
+// alg.
+func keyedSum(alg DigestAlgorithm, pepper, msg []byte) ([]byte, error) {
+	if len(pepper) < MinPepperLen {
+		return nil, keyError(ErrInvalidArgument, "pepper", "pepper too short")
+	}
+	mac := hmac.New(alg.newHash(), pepper)
+	mac.Write(msg)
+	return mac.Sum(nil), nil
+}
+
+// canonicalSecret returns secret without its grouping dashes, the form
+// hashed by version 2 digests.
+func canonicalSecret(secret string) string {
+	return strings.ReplaceAll(secret, "-", "")
+}
+
+// HashApiKeySecretHMAC returns a keyed digest of the user-friendly secret
+// using alg (DigestHMACSHA256 or DigestHMACSHA512) and the server-held
+// pepper. Like HashApiKeySecret it ignores the secret's dashes. The result is
+// self-describing:
+//
+//	$<alg>$v=2$<hex>
+//
+// so that ValidateApiKeyHMAC can tell it apart from the unkeyed digests
+// returned by HashApiKeySecret. pepper must be at least MinPepperLen bytes
+// and should never be stored alongside the digests.
+func HashApiKeySecretHMAC(secret string, alg DigestAlgorithm, pepper []byte) (string, error) {
+	if !alg.keyed() {
+		return "", keyError(ErrInvalidArgument, "digest", "unsupported digest algorithm")
+	}
+	d, err := computeDigest(alg, currentDigestVersion, secret, pepper)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+// GenerateApiKeyHMAC behaves like GenerateApiKey but returns a keyed digest
+// of the secret as produced by HashApiKeySecretHMAC.
+func GenerateApiKeyHMAC(prefixLen int, alg DigestAlgorithm, pepper []byte) (fullKey, prefix, hash string, err error) {
+	if !alg.keyed() {
+		return "", "", "", keyError(ErrInvalidArgument, "digest", "unsupported digest algorithm")
+	}
+	if len(pepper) < MinPepperLen {
+		return "", "", "", keyError(ErrInvalidArgument, "pepper", "pepper too short")
+	}
+	key, err := GenerateKey(KeySpec{PrefixLen: prefixLen})
+	if err != nil {
+		return "", "", "", err
+	}
+	hash, err = HashApiKeySecretHMAC(key.Secret(), alg, pepper)
+	if err != nil {
+		return "", "", "", err
+	}
+	return key.String(), key.Prefix(), hash, nil
+}
+
+// ValidateApiKeyHMAC checks fullKey against storedHash, which may be either
+// an unkeyed SHA-512 digest (HashApiKeySecret) or a keyed digest
+// (HashApiKeySecretHMAC). pepper is only consulted for keyed digests; an
+// error is returned when a keyed digest is presented without a usable pepper.
+// Comparison is done in constant time.
+func ValidateApiKeyHMAC(fullKey, storedHash string, pepper []byte) (bool, error) {
+	_, secret, err := ParseApiKey(fullKey)
+	if err != nil {
+		return false, err
+	}
+	if secret == "" {
+		return false, keyError(ErrEmpty, "secret", "empty secret")
+	}
+	return verifySecret(secret, storedHash, pepper)
+}
+
+// verifySecret compares secret against storedHash in constant time. pepper is
+// only consulted for keyed digests.
+func verifySecret(secret, storedHash string, pepper []byte) (bool, error) {
+	stored, err := parseDigest(storedHash)
+	if err != nil {
+		return false, err
+	}
+	if stored.alg.keyed() && len(pepper) == 0 {
+		return false, keyError(ErrPepperRequired, "digest", "keyed digest needs a pepper")
+	}
+	computed, err := computeDigest(stored.alg, stored.version, secret, pepper)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(computed.sum, stored.sum) == 1, nil
+}
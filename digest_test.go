@@ -0,0 +1,196 @@
+package apikey
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testPepper = []byte("0123456789abcdef0123456789abcdef")
+
+func TestGenerateAndValidateHMAC(t *testing.T) {
+	for _, alg := range []DigestAlgorithm{DigestHMACSHA256, DigestHMACSHA512} {
+		full, prefix, hash, err := GenerateApiKeyHMAC(8, alg, testPepper)
+		if err != nil {
+			t.Fatalf("GenerateApiKeyHMAC(%s) error: %v", alg, err)
+		}
+		if prefix == "" || full == "" {
+			t.Fatalf("expected non-empty prefix and full key")
+		}
+		if !isTextSafe(hash) {
+			t.Fatalf("hash is not text-safe")
+		}
+		if !strings.HasPrefix(hash, "$"+string(alg)+"$") {
+			t.Fatalf("hash %q is not tagged with %s", hash, alg)
+		}
+
+		ok, err := ValidateApiKeyHMAC(full, hash, testPepper)
+		if err != nil || !ok {
+			t.Fatalf("ValidateApiKeyHMAC(%s) should succeed, ok=%v err=%v", alg, ok, err)
+		}
+
+		otherPepper := []byte(strings.Repeat("x", MinPepperLen))
+		ok, err = ValidateApiKeyHMAC(full, hash, otherPepper)
+		if err != nil {
+			t.Fatalf("ValidateApiKeyHMAC(%s) unexpected error for wrong pepper: %v", alg, err)
+		}
+		if ok {
+			t.Fatalf("expected validation to fail with the wrong pepper")
+		}
+	}
+}
+
+func TestHashApiKeySecretHMAC_DiffersFromPlain(t *testing.T) {
+	s := "ABCD-EFGH-JKMN-PQRS-TUVW"
+	keyed, err := HashApiKeySecretHMAC(s, DigestHMACSHA512, testPepper)
+	if err != nil {
+		t.Fatalf("HashApiKeySecretHMAC error: %v", err)
+	}
+	kd, err := parseDigest(keyed)
+	if err != nil {
+		t.Fatalf("parseDigest(keyed) error: %v", err)
+	}
+	pd, err := parseDigest(HashApiKeySecret(s))
+	if err != nil {
+		t.Fatalf("parseDigest(plain) error: %v", err)
+	}
+	if bytes.Equal(kd.sum, pd.sum) {
+		t.Fatalf("keyed digest must not equal the unkeyed digest")
+	}
+	again, err := HashApiKeySecretHMAC(s, DigestHMACSHA512, testPepper)
+	if err != nil {
+		t.Fatalf("HashApiKeySecretHMAC error: %v", err)
+	}
+	if keyed != again {
+		t.Fatalf("keyed digest should be deterministic")
+	}
+}
+
+func TestHashApiKeySecretHMAC_BadInputs(t *testing.T) {
+	if _, err := HashApiKeySecretHMAC("ABCD", DigestSHA512, testPepper); err == nil {
+		t.Fatalf("expected error for unkeyed algorithm")
+	}
+	if _, err := HashApiKeySecretHMAC("ABCD", DigestHMACSHA256, []byte("short")); err == nil {
+		t.Fatalf("expected error for short pepper")
+	}
+	if _, _, _, err := GenerateApiKeyHMAC(8, DigestHMACSHA512, nil); err == nil {
+		t.Fatalf("expected error for missing pepper")
+	}
+}
+
+func TestValidateApiKeyHMAC_LegacyDigest(t *testing.T) {
+	full, _, hash, err := GenerateApiKey(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKey error: %v", err)
+	}
+	ok, err := ValidateApiKeyHMAC(full, hash, testPepper)
+	if err != nil || !ok {
+		t.Fatalf("legacy digest should still validate, ok=%v err=%v", ok, err)
+	}
+	ok, err = ValidateApiKeyHMAC(full, hash, nil)
+	if err != nil || !ok {
+		t.Fatalf("legacy digest should validate without a pepper, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestValidateApiKey_KeyedDigestNeedsPepper(t *testing.T) {
+	full, _, hash, err := GenerateApiKeyHMAC(8, DigestHMACSHA512, testPepper)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyHMAC error: %v", err)
+	}
+	if ok, err := ValidateApiKey(full, hash); err == nil || ok {
+		t.Fatalf("expected error and false for keyed digest, got ok=%v err=%v", ok, err)
+	}
+	if ok, err := ValidateApiKeyHMAC(full, hash, nil); err == nil || ok {
+		t.Fatalf("expected error and false without pepper, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestParseDigest_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"zz",
+		strings.Repeat("0", 64),
+		"$hmac-sha512$zz",
+		"$sha512$" + strings.Repeat("0", 128),
+		"$hmac-md5$" + strings.Repeat("0", 32),
+		"$hmac-sha256$" + strings.Repeat("0", 128),
+		"$sha512$k=abc$v=2$" + strings.Repeat("0", 128),
+		"$sha512$v=2$k=abc$" + strings.Repeat("0", 128),
+		"$sha512$v=x$" + strings.Repeat("0", 128),
+		"$sha512$v=3$" + strings.Repeat("0", 128),
+		"$hmac-sha512$v=2$k=a$k=b$" + strings.Repeat("0", 128),
+	} {
+		if _, err := parseDigest(s); err == nil {
+			t.Fatalf("expected error for digest %q", s)
+		}
+	}
+}
+
+// legacyDigest returns the version 1 digest of secret: bare SHA-512 hex of
+// the secret with its dashes.
+func legacyDigest(secret string) string {
+	sum := sha512.Sum512([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHashApiKeySecret_IgnoresDashes(t *testing.T) {
+	dashed := "ABCD-EFGH-JKMN-PQRS-TUVW"
+	plain := "ABCDEFGHJKMNPQRSTUVW"
+	if HashApiKeySecret(dashed) != HashApiKeySecret(plain) {
+		t.Fatalf("dash grouping should not change the digest")
+	}
+	if !strings.HasPrefix(HashApiKeySecret(plain), "$sha512$v=2$") {
+		t.Fatalf("unexpected digest format %q", HashApiKeySecret(plain))
+	}
+	a, _ := HashApiKeySecretHMAC(dashed, DigestHMACSHA256, testPepper)
+	b, _ := HashApiKeySecretHMAC(plain, DigestHMACSHA256, testPepper)
+	if a != b || !strings.HasPrefix(a, "$hmac-sha256$v=2$") {
+		t.Fatalf("keyed digests should ignore dashes: %q vs %q", a, b)
+	}
+}
+
+func TestValidateApiKey_DigestVersions(t *testing.T) {
+	k, err := GenerateKey(KeySpec{PrefixLen: 8})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	regrouped := k.Prefix() + separator + canonicalSecret(k.Secret())
+	for _, stored := range []string{k.Digest(), legacyDigest(k.Secret())} {
+		for _, full := range []string{k.String(), regrouped} {
+			ok, err := ValidateApiKey(full, stored)
+			if err != nil || !ok {
+				t.Fatalf("ValidateApiKey(%q, %q) ok=%v err=%v", full, stored, ok, err)
+			}
+		}
+	}
+	if ok, err := ValidateApiKey(k.String(), legacyDigest(canonicalSecret(k.Secret()))); err != nil || ok {
+		t.Fatalf("a version 1 digest covers the dashes, ok=%v err=%v", ok, err)
+	}
+	if _, err := ValidateApiKey(k.String(), "$sha512$v=9$"+strings.Repeat("0", 128)); !errors.Is(err, ErrUnsupportedHash) {
+		t.Fatalf("expected ErrUnsupportedHash for unknown version, got %v", err)
+	}
+}
+
+func TestParseDigest_RoundTrip(t *testing.T) {
+	h := strings.Repeat("ab", sha512.Size)
+	for _, s := range []string{
+		h,
+		"$sha512$v=2$" + h,
+		"$hmac-sha512$" + h,
+		"$hmac-sha512$k=2024a$" + h,
+		"$hmac-sha512$v=2$" + h,
+		"$hmac-sha512$v=2$k=2024a$" + h,
+	} {
+		d, err := parseDigest(s)
+		if err != nil {
+			t.Fatalf("parseDigest(%q) error: %v", s, err)
+		}
+		if d.String() != s {
+			t.Fatalf("round trip mismatch: got %q, want %q", d.String(), s)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package apikey
+
+import "errors"
+
+// Credential names used in Error.Credential.
+const (
+	CredentialApiKey    = "apikey"
+	CredentialBootstrap = "bootstrap"
+	CredentialPassword  = "password"
+)
+
+// Sentinel errors. Every parse and validation failure in this package wraps
+// exactly one of them, so callers can pick a response with errors.Is instead
+// of matching messages. Use errors.As with *Error for the failing field.
+var (
+	// ErrEmpty is returned when a required credential or stored value is
+	// empty.
+	ErrEmpty = errors.New("empty credential")
+	// ErrMalformed is returned when a presented credential (API key or
+	// bootstrap token) is not in a recognised format.
+	ErrMalformed = errors.New("malformed credential")
+	// ErrChecksumMismatch is returned by ParseApiKey when a key carries a
+	// checksum segment that does not match its prefix and secret, which
+	// almost always means the key was mistyped or truncated.
+	ErrChecksumMismatch = errors.New("api key checksum mismatch")
+	// ErrKindNotAllowed is returned by ValidateApiKeyKind when a key's kind is
+	// not accepted by the caller, e.g. a test key presented to a live server.
+	ErrKindNotAllowed = errors.New("api key kind not allowed")
+	// ErrMalformedHash is returned when a stored digest or hash cannot be
+	// decoded. It points at corrupt storage rather than a bad client.
+	ErrMalformedHash = errors.New("malformed stored hash")
+	// ErrUnsupportedHash is returned when a stored digest or hash uses an
+	// algorithm, version or parameter this package does not implement.
+	ErrUnsupportedHash = errors.New("unsupported stored hash")
+	// ErrPepperRequired is returned when a keyed digest is checked without a
+	// pepper.
+	ErrPepperRequired = errors.New("pepper required for keyed digest")
+	// ErrUnknownPepper is returned when a keyed digest references a pepper ID
+	// that is not in the Keyring.
+	ErrUnknownPepper = errors.New("unknown pepper id")
+	// ErrInvalidArgument is returned for invalid configuration passed by the
+	// caller, such as a short pepper or an unknown vendor tag.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrMismatch is returned by a Validator when a well-formed credential
+	// does not match the stored digest.
+	ErrMismatch = errors.New("credential mismatch")
+	// ErrRevoked is returned for credentials that have been revoked.
+	ErrRevoked = errors.New("credential revoked")
+	// ErrExpired is returned for credentials presented after their expiry.
+	ErrExpired = errors.New("credential expired")
+	// ErrConsumed is returned when a single-use bootstrap token is redeemed
+	// again.
+	ErrConsumed = errors.New("credential already used")
+	// ErrNotFound is returned by a Store when no record matches.
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicatePrefix is returned by Store.Insert when a record with the
+	// same prefix already exists.
+	ErrDuplicatePrefix = errors.New("duplicate prefix")
+	// ErrDuplicateID is returned by BootstrapStore.InsertBootstrap when a
+	// record with the same ID already exists.
+	ErrDuplicateID = errors.New("duplicate id")
+)
+
+// Error describes why a credential or stored value was rejected. Unwrap
+// returns one of the package's sentinel errors. Error messages never include
+// secret material.
+type Error struct {
+	// Credential is one of CredentialApiKey, CredentialBootstrap or
+	// CredentialPassword.
+	Credential string
+	// Field names the failing part, e.g. "prefix", "checksum" or "salt". It
+	// is empty when the failure concerns the value as a whole.
+	Field string
+	// Reason is a short human-readable explanation.
+	Reason string
+	// Err is the sentinel error this failure belongs to.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	msg := e.Credential
+	if e.Field != "" {
+		msg += " " + e.Field
+	}
+	return msg + ": " + e.Reason
+}
+
+// Unwrap returns the sentinel error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// keyError returns an *Error for an API key failure.
+func keyError(err error, field, reason string) error {
+	return &Error{Credential: CredentialApiKey, Field: field, Reason: reason, Err: err}
+}
+
+// bootstrapError returns an *Error for a bootstrap token failure.
+func bootstrapError(err error, field, reason string) error {
+	return &Error{Credential: CredentialBootstrap, Field: field, Reason: reason, Err: err}
+}
+
+// passwordError returns an *Error for a password failure.
+func passwordError(err error, field, reason string) error {
+	return &Error{Credential: CredentialPassword, Field: field, Reason: reason, Err: err}
+}
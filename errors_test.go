@@ -0,0 +1,127 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrors_ApiKey(t *testing.T) {
+	full, _, hash, err := GenerateApiKeyWithChecksum(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyWithChecksum error: %v", err)
+	}
+	cases := []struct {
+		name  string
+		key   string
+		want  error
+		field string
+	}{
+		{"empty", "", ErrEmpty, ""},
+		{"segments", "a_b_c_d_e_f", ErrMalformed, ""},
+		{"prefix", "XYZ_" + strings.Repeat("A", SecretSymbolLen), ErrMalformed, "prefix"},
+		{"secret", "abcd_" + strings.Repeat("A", SecretSymbolLen-1), ErrMalformed, "secret"},
+		{"checksum shape", full[:len(full)-1], ErrMalformed, "checksum"},
+		{"checksum value", full[:len(full)-1] + flipSymbol(full[len(full)-1]), ErrChecksumMismatch, "checksum"},
+	}
+	for _, tc := range cases {
+		_, err := ParseKey(tc.key)
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("%s: expected *Error, got %T", tc.name, err)
+		}
+		if e.Credential != CredentialApiKey || e.Field != tc.field {
+			t.Fatalf("%s: got credential=%q field=%q, want %q/%q", tc.name, e.Credential, e.Field, CredentialApiKey, tc.field)
+		}
+	}
+
+	keyed, err := HashApiKeySecretHMAC("ABCD", DigestHMACSHA256, testPepper)
+	if err != nil {
+		t.Fatalf("HashApiKeySecretHMAC error: %v", err)
+	}
+	if _, err := ValidateApiKey(full, keyed); !errors.Is(err, ErrPepperRequired) {
+		t.Fatalf("expected ErrPepperRequired, got %v", err)
+	}
+	if _, err := ValidateApiKeyHMAC(full, "$hmac-md5$00", testPepper); !errors.Is(err, ErrUnsupportedHash) {
+		t.Fatalf("expected ErrUnsupportedHash, got %v", err)
+	}
+	if _, err := ValidateApiKeyHMAC(full, "zz", testPepper); !errors.Is(err, ErrMalformedHash) {
+		t.Fatalf("expected ErrMalformedHash, got %v", err)
+	}
+	if ok, err := ValidateApiKey(full, hash); err != nil || !ok {
+		t.Fatalf("ValidateApiKey should succeed, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestErrors_Bootstrap(t *testing.T) {
+	_, stored, _, err := GenerateBootstrap()
+	if err != nil {
+		t.Fatalf("GenerateBootstrap error: %v", err)
+	}
+	cases := []struct {
+		name         string
+		plain, store string
+		want         error
+		field        string
+	}{
+		{"empty", "", stored, ErrEmpty, ""},
+		{"format", "00", "nocolon", ErrMalformedHash, "hash"},
+		{"salt", "00", "zz:00", ErrMalformedHash, "salt"},
+		{"plaintext", "not-hex", stored, ErrMalformed, "token"},
+	}
+	for _, tc := range cases {
+		_, err := ValidateBootstrap(tc.plain, tc.store)
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Credential != CredentialBootstrap || e.Field != tc.field {
+			t.Fatalf("%s: unexpected error detail %#v", tc.name, err)
+		}
+	}
+}
+
+func TestErrors_Password(t *testing.T) {
+	if _, err := HashPassword(" "); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+	cases := []struct {
+		phc  string
+		want error
+	}{
+		{"$argon2i$v=19$m=65536,t=2,p=1$bad$bad", ErrUnsupportedHash},
+		{"$argon2id$v=19$m=65536", ErrMalformedHash},
+		{"$argon2id$v=16$m=65536,t=2,p=1$AAAA$AAAA", ErrUnsupportedHash},
+		{"$argon2id$v=19$m=x,t=2,p=1$AAAA$AAAA", ErrMalformedHash},
+		{"$argon2id$v=19$m=65536,t=2,p=1$!!$AAAA", ErrMalformedHash},
+	}
+	for _, tc := range cases {
+		_, err := VerifyPassword(tc.phc, "pw")
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("%q: expected %v, got %v", tc.phc, tc.want, err)
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Credential != CredentialPassword {
+			t.Fatalf("%q: expected password *Error, got %#v", tc.phc, err)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := keyError(ErrMalformed, "prefix", "bad")
+	if err.Error() != "apikey prefix: bad" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	if msg := keyError(ErrEmpty, "", "empty key").Error(); msg != "apikey: empty key" {
+		t.Fatalf("unexpected message %q", msg)
+	}
+}
+
+// flipSymbol returns a different symbol from userFriendlyAlphabet.
+func flipSymbol(c byte) string {
+	i := strings.IndexByte(userFriendlyAlphabet, c)
+	return string(userFriendlyAlphabet[(i+1)%len(userFriendlyAlphabet)])
+}
@@ -0,0 +1,94 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// Format identifies the textual layout of an API key. ParseKey detects the
+// format of the key it is given; KeySpec.Format selects the one GenerateKey
+// produces. The zero value is FormatV1.
+type Format int
+
+const (
+	// FormatV1 is the current layout, "<prefix>_<secret>" with a dashed
+	// SecretSymbolLen-symbol secret, optionally preceded by a vendor tag and
+	// kind and followed by a checksum (see ParseApiKey).
+	FormatV1 Format = iota
+	// FormatV0 is the legacy layout "<prefix>.<secretHex>", where secretHex
+	// is LegacySecretBytes random bytes as lowercase hex. It was the format
+	// originally documented for clients and is accepted so that keys issued
+	// to them keep working. It carries no vendor, kind or checksum.
+	FormatV0
+)
+
+// LegacySecretBytes is the number of random bytes in a FormatV0 secret,
+// which is written as twice as many hex characters.
+const LegacySecretBytes = 32
+
+// legacySeparator separates prefix and secret in FormatV0 keys.
+const legacySeparator = "."
+
+// String returns "v0" or "v1".
+func (f Format) String() string {
+	switch f {
+	case FormatV0:
+		return "v0"
+	case FormatV1:
+		return "v1"
+	default:
+		return "unknown"
+	}
+}
+
+// detectFormat returns the format fullKey appears to be in. Current keys
+// always contain the separator; only legacy keys use a dot instead.
+func detectFormat(fullKey string) Format {
+	if !strings.Contains(fullKey, separator) && strings.Contains(fullKey, legacySeparator) {
+		return FormatV0
+	}
+	return FormatV1
+}
+
+// generateLegacyKey creates a FormatV0 key with a prefix of prefixLen, using
+// crypto/rand.
+func generateLegacyKey(prefixLen int) (*Key, error) {
+	prefix, err := randomPrefix(rand.Reader, prefixLen)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, LegacySecretBytes)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return &Key{format: FormatV0, sep: legacySeparator, prefix: prefix, secret: hex.EncodeToString(b)}, nil
+}
+
+// parseLegacyKey parses a FormatV0 key.
+func parseLegacyKey(fullKey string) (*Key, error) {
+	prefix, secret, _ := strings.Cut(fullKey, legacySeparator)
+	if !isValidPrefix(prefix) {
+		return nil, keyError(ErrMalformed, "prefix", "must be 1 to 16 lowercase hex characters")
+	}
+	if !isValidLegacySecret(secret) {
+		return nil, keyError(ErrMalformed, "secret", "must be 64 lowercase hex characters")
+	}
+	return &Key{format: FormatV0, sep: legacySeparator, prefix: prefix, secret: secret}, nil
+}
+
+// isValidLegacySecret validates a FormatV0 secret: exactly
+// 2*LegacySecretBytes lowercase hex characters.
+func isValidLegacySecret(s string) bool {
+	if len(s) != 2*LegacySecretBytes {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, f := range []Format{FormatV1, FormatV0} {
+		k, err := GenerateKey(KeySpec{PrefixLen: 12, Format: f})
+		if err != nil {
+			t.Fatalf("GenerateKey(%v) error: %v", f, err)
+		}
+		if k.Format() != f {
+			t.Fatalf("Format() = %v, want %v", k.Format(), f)
+		}
+		parsed, err := ParseKey(k.String())
+		if err != nil {
+			t.Fatalf("ParseKey(%q) error: %v", k.String(), err)
+		}
+		if *parsed != *k {
+			t.Fatalf("%v round trip mismatch: got %+v, want %+v", f, *parsed, *k)
+		}
+		prefix, secret, err := ParseApiKey(k.String())
+		if err != nil || prefix != k.Prefix() || secret != k.Secret() {
+			t.Fatalf("ParseApiKey(%q) = %q, %q, %v", k.String(), prefix, secret, err)
+		}
+		ok, err := ValidateApiKey(k.String(), HashApiKeySecret(secret))
+		if err != nil || !ok {
+			t.Fatalf("ValidateApiKey(%v) ok=%v err=%v", f, ok, err)
+		}
+	}
+}
+
+func TestFormatV0_Layout(t *testing.T) {
+	k, err := GenerateKey(KeySpec{PrefixLen: 16, Format: FormatV0})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	s := k.String()
+	if len(s) != 16+1+2*LegacySecretBytes || s[16] != '.' || !isTextSafe(s) {
+		t.Fatalf("unexpected v0 key %q", s)
+	}
+	if got, want := k.Redacted(), k.Prefix()+".****"; got != want {
+		t.Fatalf("Redacted() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatV0_Malformed(t *testing.T) {
+	hex64 := strings.Repeat("ab", LegacySecretBytes)
+	cases := []struct {
+		key   string
+		field string
+	}{
+		{"abc." + hex64[:62], "secret"},
+		{"abc." + hex64[:63] + "g", "secret"},
+		{"abc." + hex64 + ".00", "secret"},
+		{"xyz." + hex64, "prefix"},
+		{"." + hex64, "prefix"},
+	}
+	for _, tc := range cases {
+		_, err := ParseKey(tc.key)
+		var e *Error
+		if !errors.Is(err, ErrMalformed) || !errors.As(err, &e) || e.Field != tc.field {
+			t.Fatalf("ParseKey(%q) = %v, want ErrMalformed in %s", tc.key, err, tc.field)
+		}
+	}
+}
+
+func TestGenerateKey_FormatV0Rejects(t *testing.T) {
+	for _, spec := range []KeySpec{
+		{Format: FormatV0, Checksum: true},
+		{Format: FormatV0, Vendor: "stnmgr"},
+		{Format: FormatV0, Kind: KindLive},
+		{Format: Format(7)},
+	} {
+		if _, err := GenerateKey(spec); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("GenerateKey(%+v) error = %v, want ErrInvalidArgument", spec, err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// Generator limits.
+const (
+	// DefaultGroupSize is the number of symbols between dashes in secrets
+	// from GenerateApiKey.
+	DefaultGroupSize = 4
+	// MinSecretEntropyBits is the least entropy a Generator's secrets may
+	// carry, given its secret length and alphabet.
+	MinSecretEntropyBits = 64
+	// MaxSecretLen is the largest secret length, in symbols, a Generator
+	// accepts.
+	MaxSecretLen = 128
+)
+
+// groupDash separates symbol groups inside a secret. It is never part of an
+// alphabet, so digests can ignore it (see canonicalSecret).
+const groupDash = '-'
+
+// layout describes how the secret and segments of a FormatV1 key are
+// written.
+type layout struct {
+	alphabet  string
+	secretLen int
+	// groupSize is the number of symbols between dashes; 0 disables
+	// grouping.
+	groupSize int
+	sep       string
+}
+
+// defaultLayout is the layout of keys from GenerateApiKey and the other
+// package-level functions.
+var defaultLayout = layout{
+	alphabet:  userFriendlyAlphabet,
+	secretLen: SecretSymbolLen,
+	groupSize: DefaultGroupSize,
+	sep:       separator,
+}
+
+// Generator creates and parses API keys with a configurable layout, e.g.
+// longer secrets for service accounts or short ungrouped ones for QR codes.
+// Keys from Generate are accepted by Parse on the same Generator; the
+// package-level ParseKey only accepts keys in the default layout.
+//
+// The zero Generator is not usable; create one with NewGenerator. A
+// Generator is safe for concurrent use.
+type Generator struct {
+	layout
+	rand      io.Reader
+	prefixLen int
+	vendor    string
+	kind      Kind
+	checksum  bool
+	log       *slog.Logger
+}
+
+// GeneratorOption configures a Generator.
+type GeneratorOption interface {
+	applyGenerator(*Generator)
+}
+
+// generatorOptionFunc adapts a function to GeneratorOption.
+type generatorOptionFunc func(*Generator)
+
+func (f generatorOptionFunc) applyGenerator(g *Generator) { f(g) }
+
+// WithSecretLen sets the number of symbols in the secret, excluding dashes.
+// It defaults to SecretSymbolLen.
+func WithSecretLen(n int) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.secretLen = n })
+}
+
+// WithGroupSize sets the number of symbols between dashes in the secret; 0
+// writes the secret without dashes. It defaults to DefaultGroupSize.
+func WithGroupSize(n int) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.groupSize = n })
+}
+
+// WithSeparator sets the string between the segments of a key. It must be
+// printable ASCII without letters, digits, dashes or spaces, and defaults to
+// "_".
+func WithSeparator(sep string) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.sep = sep })
+}
+
+// WithPrefixLen sets the length of the hex prefix, 1 to MaxPrefixLen. It
+// defaults to MaxPrefixLen.
+func WithPrefixLen(n int) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.prefixLen = n })
+}
+
+// WithAlphabet sets the symbols secrets and checksums are drawn from: at
+// least 2 distinct ASCII letters and digits. It defaults to the 31-symbol
+// alphabet of GenerateApiKey, which omits look-alike characters.
+func WithAlphabet(alphabet string) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.alphabet = alphabet })
+}
+
+// WithVendor brands the Generator's keys with vendor, as
+// GenerateBrandedApiKey does. Branded keys always carry a checksum.
+func WithVendor(vendor string) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.vendor = vendor })
+}
+
+// WithKind tags the Generator's keys with kind. DefaultVendorTag is used
+// unless WithVendor is given too.
+func WithKind(kind Kind) GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.kind = kind })
+}
+
+// WithChecksum appends a checksum segment to unbranded keys.
+func WithChecksum() GeneratorOption {
+	return generatorOptionFunc(func(g *Generator) { g.checksum = true })
+}
+
+// NewGenerator returns a Generator configured by opts. Without options it
+// produces the same keys as GenerateApiKey(MaxPrefixLen). It fails with
+// ErrInvalidArgument when the options are inconsistent or the secrets would
+// carry fewer than MinSecretEntropyBits bits.
+func NewGenerator(opts ...GeneratorOption) (*Generator, error) {
+	g := &Generator{layout: defaultLayout, rand: rand.Reader, prefixLen: MaxPrefixLen, log: discardLogger}
+	for _, opt := range opts {
+		opt.applyGenerator(g)
+	}
+	if g.kind != KindUnspecified && !g.kind.valid() {
+		return nil, keyError(ErrInvalidArgument, "kind", "unknown key kind")
+	}
+	if g.vendor == "" && g.kind != KindUnspecified {
+		g.vendor = DefaultVendorTag
+	}
+	if g.vendor != "" {
+		if !isValidVendor(g.vendor) {
+			return nil, keyError(ErrInvalidArgument, "vendor", "invalid vendor tag")
+		}
+		g.checksum = true
+	}
+	if g.prefixLen < 1 || g.prefixLen > MaxPrefixLen {
+		return nil, keyError(ErrInvalidArgument, "prefix", "prefix length out of range")
+	}
+	if !isValidAlphabet(g.alphabet) {
+		return nil, keyError(ErrInvalidArgument, "alphabet", "need at least 2 distinct ASCII letters and digits")
+	}
+	if g.secretLen < 1 || g.secretLen > MaxSecretLen ||
+		float64(g.secretLen)*math.Log2(float64(len(g.alphabet))) < MinSecretEntropyBits {
+		return nil, keyError(ErrInvalidArgument, "secret", "secret length out of range")
+	}
+	if g.groupSize < 0 {
+		return nil, keyError(ErrInvalidArgument, "secret", "negative group size")
+	}
+	if !isValidSeparator(g.sep) {
+		return nil, keyError(ErrInvalidArgument, "separator", "invalid separator")
+	}
+	return g, nil
+}
+
+// Generate creates a new API key. Errors from the randomness source are
+// returned unchanged.
+func (g *Generator) Generate() (*Key, error) {
+	prefix, err := randomPrefix(g.rand, g.prefixLen)
+	if err != nil {
+		g.log.Error("api key generation failed", slog.Any("err", err))
+		return nil, err
+	}
+
+	// Generate the user-friendly secret
+	symbols, err := randomSymbols(g.rand, g.alphabet, g.secretLen)
+	if err != nil {
+		g.log.Error("api key generation failed", slog.Any("err", err))
+		return nil, err
+	}
+
+	k := &Key{sep: g.sep, vendor: g.vendor, kind: g.kind, prefix: prefix, secret: g.group(symbols)}
+	if g.checksum {
+		k.checksum = keyChecksum(*k, g.alphabet)
+	}
+	g.log.Info("api key generated", slog.Any("key", k))
+	return k, nil
+}
+
+// Parse normalises and parses a key produced by Generate, verifying its
+// checksum. Keys whose vendor, kind or checksum segment differ from the
+// Generator's configuration are rejected with ErrMalformed.
+func (g *Generator) Parse(fullKey string) (*Key, error) {
+	k, err := g.parse(g.normalize(cleanKey(fullKey)))
+	if err != nil {
+		return nil, err
+	}
+	if k.vendor != g.vendor {
+		return nil, keyError(ErrMalformed, "vendor", "unexpected vendor tag")
+	}
+	if k.kind != g.kind {
+		return nil, keyError(ErrMalformed, "kind", "unexpected key kind")
+	}
+	if (k.checksum != "") != g.checksum {
+		return nil, keyError(ErrMalformed, "checksum", "unexpected checksum segment")
+	}
+	return k, nil
+}
+
+// parse parses a normalised key in any of the segment layouts accepted by
+// ParseApiKey, written with l.
+func (l *layout) parse(fullKey string) (*Key, error) {
+	if fullKey == "" {
+		return nil, keyError(ErrEmpty, "", "empty key")
+	}
+	segs := strings.Split(fullKey, l.sep)
+	k := Key{sep: l.sep}
+	switch len(segs) {
+	case 2:
+		k.prefix, k.secret = segs[0], segs[1]
+	case 3:
+		k.prefix, k.secret, k.checksum = segs[0], segs[1], segs[2]
+	case 4:
+		k.vendor, k.prefix, k.secret, k.checksum = segs[0], segs[1], segs[2], segs[3]
+		if !isValidVendor(k.vendor) {
+			return nil, keyError(ErrMalformed, "vendor", "invalid vendor tag")
+		}
+	case 5:
+		k.vendor, k.kind, k.prefix, k.secret, k.checksum = segs[0], Kind(segs[1]), segs[2], segs[3], segs[4]
+		if !isValidVendor(k.vendor) {
+			return nil, keyError(ErrMalformed, "vendor", "invalid vendor tag")
+		}
+		if !k.kind.valid() {
+			return nil, keyError(ErrMalformed, "kind", "unknown key kind")
+		}
+	default:
+		return nil, keyError(ErrMalformed, "", "unexpected number of segments")
+	}
+	if !isValidPrefix(k.prefix) {
+		return nil, keyError(ErrMalformed, "prefix", "must be 1 to 16 lowercase hex characters")
+	}
+	if !l.validSecret(k.secret) {
+		return nil, keyError(ErrMalformed, "secret", "invalid characters or length")
+	}
+	if len(segs) > 2 {
+		if !isValidChecksum(k.checksum, l.alphabet) {
+			return nil, keyError(ErrMalformed, "checksum", "invalid characters or length")
+		}
+		want := keyChecksum(k, l.alphabet)
+		if subtle.ConstantTimeCompare([]byte(k.checksum), []byte(want)) != 1 {
+			return nil, keyError(ErrChecksumMismatch, "checksum", "does not match key")
+		}
+	}
+	return &k, nil
+}
+
+// group inserts a dash every l.groupSize symbols for readability.
+func (l *layout) group(s string) string {
+	if l.groupSize <= 0 {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i > 0 && i%l.groupSize == 0 {
+			sb.WriteByte(groupDash)
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// validSecret validates a secret. It must consist only of characters from
+// l.alphabet and optional dashes, and have exactly l.secretLen symbols once
+// the dashes are removed.
+func (l *layout) validSecret(s string) bool {
+	if s == "" {
+		return false
+	}
+	plainCount := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == groupDash {
+			continue
+		}
+		plainCount++
+		if strings.IndexByte(l.alphabet, c) < 0 {
+			return false
+		}
+	}
+	return plainCount == l.secretLen
+}
+
+// isValidAlphabet reports whether a is at least 2 distinct ASCII letters and
+// digits.
+func isValidAlphabet(a string) bool {
+	if len(a) < 2 {
+		return false
+	}
+	var seen [128]bool
+	for i := 0; i < len(a); i++ {
+		c := a[i]
+		if c >= 128 || seen[c] || !isAlnum(c) {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+// isValidSeparator reports whether sep can delimit key segments without
+// being confused with their contents.
+func isValidSeparator(sep string) bool {
+	if sep == "" {
+		return false
+	}
+	for i := 0; i < len(sep); i++ {
+		c := sep[i]
+		if c <= ' ' || c >= 127 || c == groupDash || isAlnum(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlnum reports whether c is an ASCII letter or digit.
+func isAlnum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
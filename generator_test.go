@@ -0,0 +1,145 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerator_Default(t *testing.T) {
+	g, err := NewGenerator()
+	if err != nil {
+		t.Fatalf("NewGenerator error: %v", err)
+	}
+	k, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if len(k.Prefix()) != MaxPrefixLen || !isValidSecret(k.Secret()) || strings.Count(k.Secret(), "-") != 4 {
+		t.Fatalf("default generator should match GenerateApiKey, got %q", k)
+	}
+	parsed, err := ParseKey(k.String())
+	if err != nil || *parsed != *k {
+		t.Fatalf("ParseKey(%q) = %+v, %v", k, parsed, err)
+	}
+}
+
+func TestGenerator_RoundTrip(t *testing.T) {
+	configs := [][]GeneratorOption{
+		{WithSecretLen(40), WithGroupSize(5)},
+		{WithSecretLen(14), WithGroupSize(0), WithAlphabet("ABCDEFGHJKMNPQRSTUVWXYZ23456789abcdefghjkmnpqrstuvwxyz")},
+		{WithSeparator("."), WithPrefixLen(8), WithChecksum()},
+		{WithSeparator("::"), WithKind(KindService), WithSecretLen(32)},
+		{WithAlphabet("0123456789ABCDEF"), WithSecretLen(32), WithGroupSize(8), WithVendor("stnmgr")},
+	}
+	for i, opts := range configs {
+		g, err := NewGenerator(opts...)
+		if err != nil {
+			t.Fatalf("config %d: NewGenerator error: %v", i, err)
+		}
+		k, err := g.Generate()
+		if err != nil {
+			t.Fatalf("config %d: Generate error: %v", i, err)
+		}
+		parsed, err := g.Parse(k.String())
+		if err != nil {
+			t.Fatalf("config %d: Parse(%q) error: %v", i, k, err)
+		}
+		if *parsed != *k {
+			t.Fatalf("config %d: round trip mismatch: got %+v, want %+v", i, *parsed, *k)
+		}
+		if !strings.Contains(k.String(), g.sep) || !isTextSafe(k.String()) {
+			t.Fatalf("config %d: unexpected key %q", i, k)
+		}
+		if k.Digest() != HashApiKeySecret(canonicalSecret(k.Secret())) {
+			t.Fatalf("config %d: digest should ignore grouping", i)
+		}
+	}
+}
+
+func TestGenerator_Layout(t *testing.T) {
+	g, err := NewGenerator(WithSecretLen(15), WithGroupSize(0), WithPrefixLen(6))
+	if err != nil {
+		t.Fatalf("NewGenerator error: %v", err)
+	}
+	k, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if len(k.Prefix()) != 6 || len(k.Secret()) != 15 || strings.Contains(k.Secret(), "-") {
+		t.Fatalf("unexpected layout %q", k)
+	}
+	// the default parser expects 20 symbols
+	if _, err := ParseKey(k.String()); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("ParseKey should reject a custom layout, got %v", err)
+	}
+	// typed leniently: lowercase and regrouped
+	typed := strings.ToLower(k.Prefix() + "_" + k.Secret()[:5] + " - " + k.Secret()[5:])
+	if parsed, err := g.Parse(typed); err != nil || *parsed != *k {
+		t.Fatalf("Parse(%q) = %+v, %v", typed, parsed, err)
+	}
+}
+
+func TestGenerator_ParseRejectsOtherConfig(t *testing.T) {
+	plain, _ := NewGenerator()
+	checked, _ := NewGenerator(WithChecksum())
+	live, _ := NewGenerator(WithKind(KindLive))
+	test, _ := NewGenerator(WithKind(KindTest))
+
+	pk, _ := plain.Generate()
+	if _, err := checked.Parse(pk.String()); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("checksum generator accepted a key without checksum: %v", err)
+	}
+	lk, _ := live.Generate()
+	if _, err := test.Parse(lk.String()); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("test generator accepted a live key: %v", err)
+	}
+}
+
+func TestNewGenerator_Invalid(t *testing.T) {
+	for _, opts := range [][]GeneratorOption{
+		{WithSecretLen(0)},
+		{WithSecretLen(MaxSecretLen + 1)},
+		{WithSecretLen(12)}, // 12 * log2(31) < 64 bits
+		{WithGroupSize(-1)},
+		{WithSeparator("")},
+		{WithSeparator("-")},
+		{WithSeparator("x")},
+		{WithSeparator(" ")},
+		{WithPrefixLen(0)},
+		{WithPrefixLen(MaxPrefixLen + 1)},
+		{WithAlphabet("A")},
+		{WithAlphabet("AAB")},
+		{WithAlphabet("AB-C")},
+		{WithVendor("abc")},
+		{WithKind("prod")},
+	} {
+		if _, err := NewGenerator(opts...); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("expected ErrInvalidArgument, got %v", err)
+		}
+	}
+}
+
+func TestValidator_WithGenerator(t *testing.T) {
+	ctx := context.Background()
+	g, err := NewGenerator(WithSecretLen(32), WithGroupSize(8))
+	if err != nil {
+		t.Fatalf("NewGenerator error: %v", err)
+	}
+	k, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	store := NewMemoryStore()
+	if err := store.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest(), CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if _, err := NewValidator(store, WithGenerator(g)).Validate(ctx, k.String()); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	if _, err := NewValidator(store).Validate(ctx, k.String()); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("default Validator should reject a custom layout, got %v", err)
+	}
+}
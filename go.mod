@@ -2,6 +2,9 @@ module github.com/Station-Manager/apikey
 
 go 1.25
 
-require golang.org/x/crypto v0.46.0
+require (
+	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/crypto v0.46.0
+)
 
 require golang.org/x/sys v0.39.0 // indirect
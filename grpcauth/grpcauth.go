@@ -0,0 +1,137 @@
+// Package grpcauth authenticates gRPC calls with API keys.
+//
+// Clients attach a key with Credentials; servers install
+// UnaryServerInterceptor and StreamServerInterceptor. The key travels in the
+// "authorization" metadata entry using the same "ApiKey <key>" form as the
+// HTTP middleware, and the authenticated apikey.Record is available to
+// handlers through apikey.PrincipalFromContext.
+//
+// grpcauth is its own module, so that users of apikey alone do not depend
+// on gRPC. It requires a tagged apikey release; within this repository the
+// go.work file builds it against the local apikey sources instead.
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Station-Manager/apikey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey is the metadata entry carrying the key.
+const MetadataKey = "authorization"
+
+// UnaryServerInterceptor returns an interceptor that authenticates every
+// unary call with auth. Calls without a valid key fail with
+// codes.Unauthenticated, and valid keys of a kind the authenticator does not
+// allow with codes.PermissionDenied, matching the HTTP middleware's 403;
+// errors that do not concern the key, such as a storage failure, fail with
+// codes.Internal.
+func UnaryServerInterceptor(auth apikey.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, auth)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(auth apikey.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), auth)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// authenticate validates the key in ctx's incoming metadata and returns ctx
+// carrying the principal, or a status error.
+func authenticate(ctx context.Context, auth apikey.Authenticator) (context.Context, error) {
+	key, err := keyFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := auth.Validate(ctx, key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return apikey.ContextWithPrincipal(ctx, rec), nil
+}
+
+// keyFromMetadata extracts the key from the single authorization entry.
+func keyFromMetadata(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	vals := md.Get(MetadataKey)
+	switch len(vals) {
+	case 0:
+		return "", status.Error(codes.Unauthenticated, "missing api key")
+	case 1:
+	default:
+		return "", status.Error(codes.Unauthenticated, "multiple authorization entries")
+	}
+	scheme, key, found := strings.Cut(vals[0], " ")
+	key = strings.TrimSpace(key)
+	if !found || !strings.EqualFold(scheme, apikey.AuthScheme) || key == "" {
+		return "", status.Error(codes.Unauthenticated, "malformed authorization metadata")
+	}
+	return key, nil
+}
+
+// toStatus maps an Authenticator error to a status error. Messages never
+// include the presented key.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, apikey.ErrExpired):
+		return status.Error(codes.Unauthenticated, "api key expired")
+	case errors.Is(err, apikey.ErrRevoked):
+		return status.Error(codes.Unauthenticated, "api key revoked")
+	case errors.Is(err, apikey.ErrKindNotAllowed):
+		return status.Error(codes.PermissionDenied, "api key kind not allowed")
+	case errors.Is(err, apikey.ErrEmpty), errors.Is(err, apikey.ErrMalformed),
+		errors.Is(err, apikey.ErrChecksumMismatch), errors.Is(err, apikey.ErrNotFound),
+		errors.Is(err, apikey.ErrMismatch):
+		return status.Error(codes.Unauthenticated, "invalid api key")
+	default:
+		return status.Error(codes.Internal, "api key validation failed")
+	}
+}
+
+// Credentials attaches an API key to every call. It implements
+// credentials.PerRPCCredentials; pass it with grpc.WithPerRPCCredentials or
+// grpc.PerRPCCredentials.
+type Credentials struct {
+	// Key is the full API key. It is sensitive.
+	Key string
+	// AllowInsecure permits sending the key over connections without
+	// transport security. Only set it for local testing.
+	AllowInsecure bool
+}
+
+var _ credentials.PerRPCCredentials = Credentials{}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c Credentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{MetadataKey: apikey.AuthScheme + " " + c.Key}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c Credentials) RequireTransportSecurity() bool { return !c.AllowInsecure }
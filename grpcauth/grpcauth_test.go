@@ -0,0 +1,149 @@
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Station-Manager/apikey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// principalHealth is a health server that refuses calls without a principal.
+type principalHealth struct {
+	*health.Server
+	t *testing.T
+}
+
+func (h principalHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if rec, ok := apikey.PrincipalFromContext(ctx); !ok || rec.LogbookUID != "lb-1" {
+		h.t.Errorf("unexpected principal %+v, %v", rec, ok)
+	}
+	return h.Server.Check(ctx, req)
+}
+
+func (h principalHealth) Watch(req *healthpb.HealthCheckRequest, ss healthpb.Health_WatchServer) error {
+	if rec, ok := apikey.PrincipalFromContext(ss.Context()); !ok || rec.LogbookUID != "lb-1" {
+		h.t.Errorf("unexpected principal %+v, %v", rec, ok)
+	}
+	return h.Server.Watch(req, ss)
+}
+
+func TestInterceptors(t *testing.T) {
+	ctx := context.Background()
+	store := apikey.NewMemoryStore()
+	k, err := apikey.GenerateKey(apikey.KeySpec{PrefixLen: 12})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if err := store.Insert(ctx, apikey.Record{Prefix: k.Prefix(), Digest: k.Digest(), LogbookUID: "lb-1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	v := apikey.NewValidator(store)
+
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(v)),
+		grpc.StreamInterceptor(StreamServerInterceptor(v)),
+	)
+	healthpb.RegisterHealthServer(srv, principalHealth{Server: health.NewServer(), t: t})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	dial := func(key string) healthpb.HealthClient {
+		conn, err := grpc.NewClient("passthrough:///bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(Credentials{Key: key, AllowInsecure: true}))
+		if err != nil {
+			t.Fatalf("NewClient error: %v", err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return healthpb.NewHealthClient(conn)
+	}
+
+	good := dial(k.String())
+	if _, err := good.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("unary call with valid key failed: %v", err)
+	}
+	stream, err := good.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch error: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("stream call with valid key failed: %v", err)
+	}
+
+	other, _ := apikey.GenerateKey(apikey.KeySpec{PrefixLen: 12})
+	bad := dial(other.String())
+	if _, err := bad.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("unary call with unknown key: %v", err)
+	}
+	stream, err = bad.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("stream call with unknown key: %v", err)
+	}
+}
+
+func TestKeyFromMetadata(t *testing.T) {
+	cases := []struct {
+		md   metadata.MD
+		key  string
+		code codes.Code
+	}{
+		{metadata.Pairs(MetadataKey, "ApiKey abc_def"), "abc_def", codes.OK},
+		{metadata.Pairs(MetadataKey, "apikey  abc_def "), "abc_def", codes.OK},
+		{nil, "", codes.Unauthenticated},
+		{metadata.Pairs(MetadataKey, "Bearer abc"), "", codes.Unauthenticated},
+		{metadata.Pairs(MetadataKey, "ApiKey"), "", codes.Unauthenticated},
+		{metadata.Pairs(MetadataKey, "ApiKey a", MetadataKey, "ApiKey b"), "", codes.Unauthenticated},
+	}
+	for _, tc := range cases {
+		ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+		key, err := keyFromMetadata(ctx)
+		if key != tc.key || status.Code(err) != tc.code {
+			t.Fatalf("keyFromMetadata(%v) = %q, %v; want %q, %v", tc.md, key, err, tc.key, tc.code)
+		}
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{apikey.ErrMismatch, codes.Unauthenticated},
+		{apikey.ErrRevoked, codes.Unauthenticated},
+		{apikey.ErrKindNotAllowed, codes.PermissionDenied},
+		{apikey.ErrMalformedHash, codes.Internal},
+		{errors.New("database unavailable"), codes.Internal},
+	}
+	for _, tc := range cases {
+		if got := status.Code(toStatus(tc.err)); got != tc.code {
+			t.Fatalf("toStatus(%v) = %v, want %v", tc.err, got, tc.code)
+		}
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	c := Credentials{Key: "abc_def"}
+	md, err := c.GetRequestMetadata(context.Background())
+	if err != nil || md[MetadataKey] != "ApiKey abc_def" {
+		t.Fatalf("GetRequestMetadata = %v, %v", md, err)
+	}
+	if !c.RequireTransportSecurity() {
+		t.Fatalf("credentials must require transport security by default")
+	}
+}
@@ -0,0 +1,140 @@
+package apikey
+
+import "log/slog"
+
+// redactedSecret replaces the secret (and checksum) in Key.Redacted.
+const redactedSecret = "****"
+
+// KeySpec describes the API key GenerateKey should create. The zero value
+// yields the same "<prefix>_<secret>" key as GenerateApiKey(MaxPrefixLen).
+type KeySpec struct {
+	// PrefixLen is the length of the hex prefix. Values <= 0 or above
+	// MaxPrefixLen are clamped to MaxPrefixLen.
+	PrefixLen int
+	// Vendor brands the key (see GenerateBrandedApiKey). Branded keys always
+	// carry a checksum.
+	Vendor string
+	// Kind tags the key (see GenerateApiKeyKind). Kinds are only encoded in
+	// branded keys, so DefaultVendorTag is used when Vendor is empty.
+	Kind Kind
+	// Checksum appends a checksum segment to unbranded keys.
+	Checksum bool
+	// Format selects the key layout. FormatV0 keys cannot carry a vendor,
+	// kind or checksum.
+	Format Format
+}
+
+// Key is an API key, either freshly generated by GenerateKey or parsed from
+// its string form by ParseKey. The secret it holds is sensitive: String and
+// Secret expose it, Redacted does not.
+type Key struct {
+	format Format
+	// sep separates the segments; see WithSeparator.
+	sep string
+	// vendor is the brand tag of branded keys and empty otherwise.
+	vendor string
+	// kind is only encoded in branded keys.
+	kind   Kind
+	prefix string
+	// secret is the user-friendly secret, including any dashes.
+	secret string
+	// checksum is empty for keys without a checksum segment.
+	checksum string
+}
+
+// GenerateKey creates a new API key as described by spec.
+func GenerateKey(spec KeySpec) (*Key, error) {
+	prefixLen := spec.PrefixLen
+	if prefixLen <= 0 || prefixLen > MaxPrefixLen {
+		prefixLen = MaxPrefixLen
+	}
+	switch spec.Format {
+	case FormatV1:
+	case FormatV0:
+		if spec.Vendor != "" || spec.Kind != KindUnspecified || spec.Checksum {
+			return nil, keyError(ErrInvalidArgument, "format", "v0 keys carry no vendor, kind or checksum")
+		}
+		return generateLegacyKey(prefixLen)
+	default:
+		return nil, keyError(ErrInvalidArgument, "format", "unknown key format")
+	}
+	opts := []GeneratorOption{WithPrefixLen(prefixLen), WithVendor(spec.Vendor), WithKind(spec.Kind)}
+	if spec.Checksum {
+		opts = append(opts, WithChecksum())
+	}
+	g, err := NewGenerator(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return g.Generate()
+}
+
+// ParseKey normalises fullKey with NormalizeApiKey, then parses and
+// validates it in any of the layouts accepted by ParseApiKey, verifying the
+// checksum when one is present.
+func ParseKey(fullKey string) (*Key, error) {
+	fullKey = NormalizeApiKey(fullKey)
+	if fullKey == "" {
+		return nil, keyError(ErrEmpty, "", "empty key")
+	}
+	if detectFormat(fullKey) == FormatV0 {
+		return parseLegacyKey(fullKey)
+	}
+	return defaultLayout.parse(fullKey)
+}
+
+// Format returns the key's layout.
+func (k *Key) Format() Format { return k.format }
+
+// Prefix returns the lowercase hex lookup prefix.
+func (k *Key) Prefix() string { return k.prefix }
+
+// Secret returns the user-friendly secret, or the hex secret of a FormatV0
+// key. It is sensitive.
+func (k *Key) Secret() string { return k.secret }
+
+// Vendor returns the vendor tag of a branded key, or "".
+func (k *Key) Vendor() string { return k.vendor }
+
+// Kind returns the key's kind, or KindUnspecified.
+func (k *Key) Kind() Kind { return k.kind }
+
+// Checksum returns the checksum segment, or "" when the key has none.
+func (k *Key) Checksum() string { return k.checksum }
+
+// Digest returns the SHA-512 digest of the secret, "$sha512$v=2$<hex>", as
+// HashApiKeySecret would. Use a Keyring or HashApiKeySecretHMAC for keyed
+// digests.
+func (k *Key) Digest() string { return HashApiKeySecret(k.secret) }
+
+// Redacted returns the key with its secret and checksum masked, e.g.
+// "smk_live_3fa9c1_****". It is safe to log.
+func (k *Key) Redacted() string {
+	r := *k
+	r.secret = redactedSecret
+	return r.body()
+}
+
+// LogValue implements slog.LogValuer, so a logged Key shows up as Redacted.
+func (k *Key) LogValue() slog.Value { return slog.StringValue(k.Redacted()) }
+
+// String returns the full key as handed to clients. It is sensitive.
+func (k *Key) String() string {
+	s := k.body()
+	if k.checksum != "" {
+		s += k.sep + k.checksum
+	}
+	return s
+}
+
+// body returns the key without its checksum segment.
+func (k Key) body() string {
+	s := k.prefix + k.sep + k.secret
+	if k.kind != KindUnspecified {
+		s = string(k.kind) + k.sep + s
+	}
+	if k.vendor != "" {
+		s = k.vendor + k.sep + s
+	}
+	return s
+}
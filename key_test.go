@@ -0,0 +1,74 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateKeyAndParseKey(t *testing.T) {
+	specs := []KeySpec{
+		{},
+		{PrefixLen: 6, Checksum: true},
+		{PrefixLen: 8, Vendor: "stnmgr"},
+		{PrefixLen: 10, Kind: KindLive},
+		{PrefixLen: 12, Vendor: "stnmgr", Kind: KindReadOnly},
+	}
+	for _, spec := range specs {
+		k, err := GenerateKey(spec)
+		if err != nil {
+			t.Fatalf("GenerateKey(%+v) error: %v", spec, err)
+		}
+		parsed, err := ParseKey(k.String())
+		if err != nil {
+			t.Fatalf("ParseKey(%q) error: %v", k.String(), err)
+		}
+		if *parsed != *k {
+			t.Fatalf("round trip mismatch: got %+v, want %+v", *parsed, *k)
+		}
+		if parsed.Digest() != HashApiKeySecret(k.Secret()) {
+			t.Fatalf("Digest should match HashApiKeySecret")
+		}
+		ok, err := ValidateApiKey(k.String(), k.Digest())
+		if err != nil || !ok {
+			t.Fatalf("ValidateApiKey should succeed for %q, ok=%v err=%v", k, ok, err)
+		}
+	}
+}
+
+func TestGenerateKey_SpecDefaults(t *testing.T) {
+	k, err := GenerateKey(KeySpec{Kind: KindTest})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if k.Vendor() != DefaultVendorTag || k.Kind() != KindTest {
+		t.Fatalf("expected %s/%s, got %s/%s", DefaultVendorTag, KindTest, k.Vendor(), k.Kind())
+	}
+	if len(k.Prefix()) != MaxPrefixLen {
+		t.Fatalf("expected prefix length %d, got %d", MaxPrefixLen, len(k.Prefix()))
+	}
+	if k.Checksum() == "" {
+		t.Fatalf("branded keys must carry a checksum")
+	}
+
+	if _, err := GenerateKey(KeySpec{Kind: Kind("prod")}); err == nil {
+		t.Fatalf("expected error for unknown kind")
+	}
+	if _, err := GenerateKey(KeySpec{Vendor: "abc"}); err == nil {
+		t.Fatalf("expected error for invalid vendor")
+	}
+}
+
+func TestKeyRedacted(t *testing.T) {
+	k, err := GenerateKey(KeySpec{PrefixLen: 6, Kind: KindLive})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	r := k.Redacted()
+	want := DefaultVendorTag + "_live_" + k.Prefix() + "_" + redactedSecret
+	if r != want {
+		t.Fatalf("Redacted = %q, want %q", r, want)
+	}
+	if strings.Contains(r, k.Secret()) || strings.Contains(r, k.Checksum()) {
+		t.Fatalf("Redacted leaks the secret or checksum: %q", r)
+	}
+}
@@ -0,0 +1,234 @@
+package apikey
+
+import (
+	"crypto/subtle"
+	"sync"
+)
+
+// maxPepperIDLen bounds the pepper ID embedded in stored digests.
+const maxPepperIDLen = 32
+
+// Keyring holds the HMAC peppers used to digest API key secrets, indexed by
+// a short pepper ID. Exactly one pepper is current: new digests are computed
+// with it and embed its ID ("$<alg>$v=2$k=<id>$<hex>"), while digests made with
+// any other pepper still in the ring keep validating until they are re-hashed.
+//
+// A pepper registered under the empty ID is used for keyed digests that carry
+// no pepper ID (those produced by HashApiKeySecretHMAC before a keyring was
+// introduced). The empty ID can never be made current.
+//
+// A Keyring is safe for concurrent use; peppers may be added and rotated
+// while it is serving validations.
+type Keyring struct {
+	mu      sync.RWMutex
+	alg     DigestAlgorithm
+	current string
+	peppers map[string][]byte
+}
+
+// NewKeyring returns an empty keyring producing digests with alg, which must
+// be DigestHMACSHA256 or DigestHMACSHA512. Add a pepper and select it with
+// SetCurrent before hashing.
+func NewKeyring(alg DigestAlgorithm) (*Keyring, error) {
+	if !alg.keyed() {
+		return nil, keyError(ErrInvalidArgument, "digest", "unsupported digest algorithm")
+	}
+	return &Keyring{alg: alg, peppers: make(map[string][]byte)}, nil
+}
+
+// Add registers pepper under id, replacing any pepper already using that ID.
+// The pepper is copied. id must be empty (see Keyring) or 1 to 32 characters
+// from [A-Za-z0-9._-].
+func (k *Keyring) Add(id string, pepper []byte) error {
+	if id != "" && !isValidPepperID(id) {
+		return keyError(ErrInvalidArgument, "pepper", "invalid pepper id")
+	}
+	if len(pepper) < MinPepperLen {
+		return keyError(ErrInvalidArgument, "pepper", "pepper too short")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.peppers[id] = append([]byte(nil), pepper...)
+	return nil
+}
+
+// Remove drops the pepper registered under id. Digests computed with it no
+// longer validate. The current pepper cannot be removed.
+func (k *Keyring) Remove(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.current != "" && id == k.current {
+		return keyError(ErrInvalidArgument, "pepper", "cannot remove current pepper")
+	}
+	delete(k.peppers, id)
+	return nil
+}
+
+// SetCurrent selects the pepper used for new digests. The pepper must have
+// been registered with Add.
+func (k *Keyring) SetCurrent(id string) error {
+	if id == "" {
+		return keyError(ErrInvalidArgument, "pepper", "invalid pepper id")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.peppers[id]; !ok {
+		return keyError(ErrUnknownPepper, "pepper", "unknown pepper id")
+	}
+	k.current = id
+	return nil
+}
+
+// Current returns the ID of the current pepper, or "" if none is set.
+func (k *Keyring) Current() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// HashApiKeySecret returns the keyed digest of secret under the current
+// pepper, in the form "$<alg>$v=2$k=<id>$<hex>".
+func (k *Keyring) HashApiKeySecret(secret string) (string, error) {
+	k.mu.RLock()
+	id, alg := k.current, k.alg
+	pepper := k.peppers[id]
+	k.mu.RUnlock()
+	if id == "" {
+		return "", keyError(ErrInvalidArgument, "pepper", "no current pepper")
+	}
+	d, err := computeDigest(alg, currentDigestVersion, secret, pepper)
+	if err != nil {
+		return "", err
+	}
+	d.pepperID = id
+	return d.String(), nil
+}
+
+// GenerateApiKey behaves like the package-level GenerateApiKey but returns
+// a digest computed with the current pepper.
+func (k *Keyring) GenerateApiKey(prefixLen int) (fullKey, prefix, hash string, err error) {
+	if k.Current() == "" {
+		return "", "", "", keyError(ErrInvalidArgument, "pepper", "no current pepper")
+	}
+	key, err := GenerateKey(KeySpec{PrefixLen: prefixLen})
+	if err != nil {
+		return "", "", "", err
+	}
+	hash, err = k.HashApiKeySecret(key.Secret())
+	if err != nil {
+		return "", "", "", err
+	}
+	return key.String(), key.Prefix(), hash, nil
+}
+
+// ValidateApiKey checks fullKey against storedHash using the pepper the
+// digest references. Unkeyed SHA-512 digests are accepted as well.
+//
+// When ok is true, rehash reports whether storedHash should be replaced by
+// a fresh digest from HashApiKeySecret because it was not computed with the
+// current pepper, algorithm and digest version. rehash is always false when
+// ok is false.
+func (k *Keyring) ValidateApiKey(fullKey, storedHash string) (ok, rehash bool, err error) {
+	_, secret, err := ParseApiKey(fullKey)
+	if err != nil {
+		return false, false, err
+	}
+	if secret == "" {
+		return false, false, keyError(ErrEmpty, "secret", "empty secret")
+	}
+	return k.verify(secret, storedHash)
+}
+
+// verify compares secret against storedHash using the pepper the digest
+// references; see ValidateApiKey for the meaning of the results.
+func (k *Keyring) verify(secret, storedHash string) (ok, rehash bool, err error) {
+	stored, err := parseDigest(storedHash)
+	if err != nil {
+		return false, false, err
+	}
+	var pepper []byte
+	if stored.alg.keyed() {
+		k.mu.RLock()
+		p, found := k.peppers[stored.pepperID]
+		k.mu.RUnlock()
+		if !found {
+			return false, false, keyError(ErrUnknownPepper, "digest", "digest references unknown pepper id")
+		}
+		pepper = p
+	}
+	computed, err := computeDigest(stored.alg, stored.version, secret, pepper)
+	if err != nil {
+		return false, false, err
+	}
+	if subtle.ConstantTimeCompare(computed.sum, stored.sum) != 1 {
+		return false, false, nil
+	}
+	return true, k.needsRehash(stored), nil
+}
+
+// bootstrapDigest returns the keyed digest of a bootstrap hash input under
+// the current pepper. It has the storage form of an API key digest, but
+// covers a domain-separated input (see bootstrapHMACInput) rather than a
+// secret.
+func (k *Keyring) bootstrapDigest(input []byte) (string, error) {
+	k.mu.RLock()
+	id, alg := k.current, k.alg
+	pepper := k.peppers[id]
+	k.mu.RUnlock()
+	if id == "" {
+		return "", keyError(ErrInvalidArgument, "pepper", "no current pepper")
+	}
+	sum, err := keyedSum(alg, pepper, input)
+	if err != nil {
+		return "", err
+	}
+	return digest{alg: alg, version: currentDigestVersion, pepperID: id, sum: sum}.String(), nil
+}
+
+// verifyBootstrapDigest reports whether stored, a keyed digest, is the
+// bootstrap digest of input under the pepper it references.
+func (k *Keyring) verifyBootstrapDigest(input []byte, stored digest) (bool, error) {
+	k.mu.RLock()
+	pepper, found := k.peppers[stored.pepperID]
+	k.mu.RUnlock()
+	if !found {
+		return false, keyError(ErrUnknownPepper, "digest", "digest references unknown pepper id")
+	}
+	sum, err := keyedSum(stored.alg, pepper, input)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(sum, stored.sum) == 1, nil
+}
+
+// NeedsRehash reports whether storedHash was computed with anything other
+// than the current pepper, algorithm and digest version. Malformed digests
+// always need replacing.
+func (k *Keyring) NeedsRehash(storedHash string) bool {
+	stored, err := parseDigest(storedHash)
+	if err != nil {
+		return true
+	}
+	return k.needsRehash(stored)
+}
+
+func (k *Keyring) needsRehash(d digest) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return d.alg != k.alg || d.pepperID != k.current || d.version != currentDigestVersion
+}
+
+// isValidPepperID reports whether id may be embedded in a stored digest.
+func isValidPepperID(id string) bool {
+	if id == "" || len(id) > maxPepperIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
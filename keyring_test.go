@@ -0,0 +1,159 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	kr, err := NewKeyring(DigestHMACSHA512)
+	if err != nil {
+		t.Fatalf("NewKeyring error: %v", err)
+	}
+	if err := kr.Add("2024a", []byte(strings.Repeat("a", 32))); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if err := kr.SetCurrent("2024a"); err != nil {
+		t.Fatalf("SetCurrent error: %v", err)
+	}
+	return kr
+}
+
+func TestKeyringGenerateAndValidate(t *testing.T) {
+	kr := newTestKeyring(t)
+	full, _, hash, err := kr.GenerateApiKey(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKey error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$hmac-sha512$v=2$k=2024a$") {
+		t.Fatalf("digest %q does not embed the pepper id", hash)
+	}
+	ok, rehash, err := kr.ValidateApiKey(full, hash)
+	if err != nil || !ok {
+		t.Fatalf("ValidateApiKey should succeed, ok=%v err=%v", ok, err)
+	}
+	if rehash {
+		t.Fatalf("digest under the current pepper should not need rehashing")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	kr := newTestKeyring(t)
+	full, _, oldHash, err := kr.GenerateApiKey(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKey error: %v", err)
+	}
+
+	if err := kr.Add("2025a", []byte(strings.Repeat("b", 32))); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if err := kr.SetCurrent("2025a"); err != nil {
+		t.Fatalf("SetCurrent error: %v", err)
+	}
+
+	ok, rehash, err := kr.ValidateApiKey(full, oldHash)
+	if err != nil || !ok {
+		t.Fatalf("digest under a retired pepper should still validate, ok=%v err=%v", ok, err)
+	}
+	if !rehash {
+		t.Fatalf("digest under a retired pepper should need rehashing")
+	}
+
+	_, secret, err := ParseApiKey(full)
+	if err != nil {
+		t.Fatalf("ParseApiKey error: %v", err)
+	}
+	newHash, err := kr.HashApiKeySecret(secret)
+	if err != nil {
+		t.Fatalf("HashApiKeySecret error: %v", err)
+	}
+	ok, rehash, err = kr.ValidateApiKey(full, newHash)
+	if err != nil || !ok || rehash {
+		t.Fatalf("rehashed digest should validate cleanly, ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+
+	if err := kr.Remove("2025a"); err == nil {
+		t.Fatalf("expected error removing the current pepper")
+	}
+	if err := kr.Remove("2024a"); err != nil {
+		t.Fatalf("Remove error: %v", err)
+	}
+	if ok, _, err := kr.ValidateApiKey(full, oldHash); err == nil || ok {
+		t.Fatalf("expected error for removed pepper, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestKeyringLegacyDigests(t *testing.T) {
+	kr := newTestKeyring(t)
+
+	full, _, plainHash, err := GenerateApiKey(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKey error: %v", err)
+	}
+	ok, rehash, err := kr.ValidateApiKey(full, plainHash)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("unkeyed digest should validate and need rehashing, ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+
+	full, _, unversioned, err := GenerateApiKeyHMAC(8, DigestHMACSHA512, testPepper)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyHMAC error: %v", err)
+	}
+	if ok, _, err := kr.ValidateApiKey(full, unversioned); err == nil || ok {
+		t.Fatalf("expected error for digest without a registered legacy pepper, got ok=%v err=%v", ok, err)
+	}
+	if err := kr.Add("", testPepper); err != nil {
+		t.Fatalf("Add legacy pepper error: %v", err)
+	}
+	ok, rehash, err = kr.ValidateApiKey(full, unversioned)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("unversioned digest should validate and need rehashing, ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+}
+
+func TestKeyringInvalidConfig(t *testing.T) {
+	if _, err := NewKeyring(DigestSHA512); err == nil {
+		t.Fatalf("expected error for unkeyed algorithm")
+	}
+	kr, err := NewKeyring(DigestHMACSHA256)
+	if err != nil {
+		t.Fatalf("NewKeyring error: %v", err)
+	}
+	if _, err := kr.HashApiKeySecret("ABCD"); err == nil {
+		t.Fatalf("expected error without a current pepper")
+	}
+	if err := kr.Add("bad$id", testPepper); err == nil {
+		t.Fatalf("expected error for invalid pepper id")
+	}
+	if err := kr.Add("ok", []byte("short")); err == nil {
+		t.Fatalf("expected error for short pepper")
+	}
+	if err := kr.SetCurrent("missing"); err == nil {
+		t.Fatalf("expected error for unknown pepper id")
+	}
+	if err := kr.SetCurrent(""); err == nil {
+		t.Fatalf("expected error for empty pepper id")
+	}
+}
+
+func TestKeyringRehashesVersion1Digests(t *testing.T) {
+	kr := newTestKeyring(t)
+	k, err := GenerateKey(KeySpec{PrefixLen: 8})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	v1 := digest{alg: DigestHMACSHA512, version: digestV1, pepperID: "2024a"}
+	mac, err := computeDigest(v1.alg, v1.version, k.Secret(), []byte(strings.Repeat("a", 32)))
+	if err != nil {
+		t.Fatalf("computeDigest error: %v", err)
+	}
+	v1.sum = mac.sum
+	ok, rehash, err := kr.ValidateApiKey(k.String(), v1.String())
+	if err != nil || !ok || !rehash {
+		t.Fatalf("version 1 digest should validate and need rehashing, ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	if !kr.NeedsRehash(legacyDigest(k.Secret())) {
+		t.Fatalf("unkeyed legacy digest should need rehashing")
+	}
+}
@@ -0,0 +1,94 @@
+package apikey
+
+import (
+	"slices"
+	"strconv"
+)
+
+// Kind is the type of an API key. It is encoded in branded keys right after
+// the vendor tag (e.g. "smk_live_<prefix>_<secret>_<checksum>") so a server
+// can reject keys meant for another environment before doing any hashing or
+// storage lookup.
+//
+// The kind segment is not covered by the digest, and the checksum is public,
+// so anyone holding a key can relabel it with another kind. The kind a key
+// was issued with must therefore be stored next to its digest (Record.Kind)
+// and compared once the secret has matched, as Validator and
+// ValidateApiKeyKind do.
+type Kind string
+
+const (
+	// KindUnspecified is reported for keys that carry no kind segment, i.e.
+	// those from GenerateApiKey, GenerateApiKeyWithChecksum and
+	// GenerateBrandedApiKey.
+	KindUnspecified Kind = ""
+	// KindLive marks keys for production servers.
+	KindLive Kind = "live"
+	// KindTest marks keys for staging and test servers.
+	KindTest Kind = "test"
+	// KindService marks keys held by other services rather than end users.
+	KindService Kind = "svc"
+	// KindReadOnly marks keys that must not be used for writes.
+	KindReadOnly Kind = "ro"
+)
+
+// valid reports whether k may be encoded in a key. KindUnspecified is not
+// encodable; it is expressed by omitting the kind segment.
+func (k Kind) valid() bool {
+	switch k {
+	case KindLive, KindTest, KindService, KindReadOnly:
+		return true
+	}
+	return false
+}
+
+// GenerateApiKeyKind creates a new branded API key tagged with kind:
+//
+//	<DefaultVendorTag>_<kind>_<prefix>_<secret>_<checksum>
+//
+// prefix and hash have the same meaning as for GenerateApiKey.
+func GenerateApiKeyKind(kind Kind, prefixLen int) (fullKey, prefix, hash string, err error) {
+	if !kind.valid() {
+		return "", "", "", keyError(ErrInvalidArgument, "kind", "unknown key kind")
+	}
+	k, err := GenerateKey(KeySpec{PrefixLen: prefixLen, Kind: kind})
+	if err != nil {
+		return "", "", "", err
+	}
+	return k.String(), k.Prefix(), k.Digest(), nil
+}
+
+// ParseApiKeyKind behaves like ParseApiKey and additionally returns the kind
+// encoded in the key, or KindUnspecified when it carries none.
+func ParseApiKeyKind(fullKey string) (kind Kind, prefix, secret string, err error) {
+	k, err := ParseKey(fullKey)
+	if err != nil {
+		return KindUnspecified, "", "", err
+	}
+	return k.Kind(), k.Prefix(), k.Secret(), nil
+}
+
+// ValidateApiKeyKind behaves like ValidateApiKey but also checks the key's
+// kind. storedKind is the kind the key was issued with, stored alongside
+// storedHash. Keys whose kind is not one of allowed fail with
+// ErrKindNotAllowed before the secret is hashed; keys whose secret matches
+// but whose kind segment differs from storedKind, i.e. relabelled keys, fail
+// with ErrMismatch. Include KindUnspecified in allowed to keep accepting keys
+// without a kind segment; an empty allowed accepts none.
+func ValidateApiKeyKind(fullKey, storedHash string, storedKind Kind, allowed []Kind) (bool, error) {
+	kind, _, _, err := ParseApiKeyKind(fullKey)
+	if err != nil {
+		return false, err
+	}
+	if !slices.Contains(allowed, kind) {
+		return false, keyError(ErrKindNotAllowed, "kind", "kind "+strconv.Quote(string(kind))+" not allowed")
+	}
+	ok, err := ValidateApiKey(fullKey, storedHash)
+	if err != nil || !ok {
+		return ok, err
+	}
+	if kind != storedKind {
+		return false, keyError(ErrMismatch, "kind", "does not match issued kind")
+	}
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateApiKeyKindAndParse(t *testing.T) {
+	for _, kind := range []Kind{KindLive, KindTest, KindService, KindReadOnly} {
+		full, prefix, hash, err := GenerateApiKeyKind(kind, 8)
+		if err != nil {
+			t.Fatalf("GenerateApiKeyKind(%s) error: %v", kind, err)
+		}
+		want := DefaultVendorTag + separator + string(kind) + separator + prefix + separator
+		if !strings.HasPrefix(full, want) {
+			t.Fatalf("key %q does not start with %q", full, want)
+		}
+		if !BrandedKeyPattern.MatchString(full) {
+			t.Fatalf("BrandedKeyPattern does not match %q", full)
+		}
+		gotKind, gotPrefix, _, err := ParseApiKeyKind(full)
+		if err != nil {
+			t.Fatalf("ParseApiKeyKind error: %v", err)
+		}
+		if gotKind != kind || gotPrefix != prefix {
+			t.Fatalf("ParseApiKeyKind = %s/%s, want %s/%s", gotKind, gotPrefix, kind, prefix)
+		}
+		ok, err := ValidateApiKeyKind(full, hash, kind, []Kind{kind})
+		if err != nil || !ok {
+			t.Fatalf("ValidateApiKeyKind should succeed, ok=%v err=%v", ok, err)
+		}
+	}
+}
+
+func TestValidateApiKeyKind_RejectsOtherKinds(t *testing.T) {
+	full, _, hash, err := GenerateApiKeyKind(KindTest, 8)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyKind error: %v", err)
+	}
+	ok, err := ValidateApiKeyKind(full, hash, KindTest, []Kind{KindLive, KindService, KindReadOnly})
+	if !errors.Is(err, ErrKindNotAllowed) || ok {
+		t.Fatalf("expected ErrKindNotAllowed, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestParseApiKeyKind_Unspecified(t *testing.T) {
+	full, _, hash, err := GenerateApiKey(8)
+	if err != nil {
+		t.Fatalf("GenerateApiKey error: %v", err)
+	}
+	kind, _, _, err := ParseApiKeyKind(full)
+	if err != nil {
+		t.Fatalf("ParseApiKeyKind error: %v", err)
+	}
+	if kind != KindUnspecified {
+		t.Fatalf("expected KindUnspecified, got %q", kind)
+	}
+	if _, err := ValidateApiKeyKind(full, hash, KindUnspecified, []Kind{KindLive}); !errors.Is(err, ErrKindNotAllowed) {
+		t.Fatalf("expected ErrKindNotAllowed for key without kind, got %v", err)
+	}
+	ok, err := ValidateApiKeyKind(full, hash, KindUnspecified, []Kind{KindLive, KindUnspecified})
+	if err != nil || !ok {
+		t.Fatalf("ValidateApiKeyKind should accept KindUnspecified when allowed, ok=%v err=%v", ok, err)
+	}
+	if _, err := ValidateApiKeyKind(full, hash, KindUnspecified, nil); !errors.Is(err, ErrKindNotAllowed) {
+		t.Fatalf("expected ErrKindNotAllowed for an empty allow list, got %v", err)
+	}
+}
+
+func TestParseApiKeyKind_Tampered(t *testing.T) {
+	full, _, _, err := GenerateApiKeyKind(KindTest, 8)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyKind error: %v", err)
+	}
+	// relabelling a test key as live breaks the checksum
+	relabelled := strings.Replace(full, "_test_", "_live_", 1)
+	if _, _, _, err := ParseApiKeyKind(relabelled); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch for relabelled key, got %v", err)
+	}
+	unknown := strings.Replace(full, "_test_", "_prod_", 1)
+	if _, _, _, err := ParseApiKeyKind(unknown); err == nil {
+		t.Fatalf("expected error for unknown kind")
+	}
+	if _, _, _, err := GenerateApiKeyKind(Kind("prod"), 8); err == nil {
+		t.Fatalf("expected error generating unknown kind")
+	}
+}
+
+// relabel returns k with its kind replaced and the checksum recomputed, as
+// anyone holding the key could do.
+func relabel(k *Key, kind Kind) string {
+	r := *k
+	r.kind = kind
+	if kind == KindUnspecified {
+		r.vendor, r.checksum = "", ""
+	} else {
+		r.checksum = keyChecksum(r, userFriendlyAlphabet)
+	}
+	return r.String()
+}
+
+func TestValidateApiKeyKind_Relabelled(t *testing.T) {
+	k, err := GenerateKey(KeySpec{Kind: KindReadOnly})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	for _, forged := range []string{relabel(k, KindLive), relabel(k, KindUnspecified)} {
+		if _, err := ParseKey(forged); err != nil {
+			t.Fatalf("forged key %q should parse: %v", forged, err)
+		}
+		ok, err := ValidateApiKeyKind(forged, k.Digest(), KindReadOnly, []Kind{KindLive, KindUnspecified})
+		if !errors.Is(err, ErrMismatch) || ok {
+			t.Fatalf("relabelled key %q: ok=%v err=%v, want ErrMismatch", forged, ok, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package apikey
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory Store for tests and single-node deployments.
+// Records are lost when the process exits. It also implements DigestUpdater
+// and BootstrapStore.
+//
+// A MemoryStore is safe for concurrent use. The zero value is not usable;
+// create one with NewMemoryStore.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	records    map[string]Record
+	bootstraps map[string]BootstrapRecord
+}
+
+var (
+	_ Store          = (*MemoryStore)(nil)
+	_ DigestUpdater  = (*MemoryStore)(nil)
+	_ BootstrapStore = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record), bootstraps: make(map[string]BootstrapRecord)}
+}
+
+// GetByPrefix implements Store.
+func (s *MemoryStore) GetByPrefix(ctx context.Context, prefix string) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[prefix]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Insert implements Store.
+func (s *MemoryStore) Insert(ctx context.Context, rec Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !isValidPrefix(rec.Prefix) {
+		return keyError(ErrInvalidArgument, "prefix", "must be 1 to 16 lowercase hex characters")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[rec.Prefix]; ok {
+		return ErrDuplicatePrefix
+	}
+	s.records[rec.Prefix] = rec
+	return nil
+}
+
+// Revoke implements Store.
+func (s *MemoryStore) Revoke(ctx context.Context, prefix string, at time.Time) error {
+	return s.update(ctx, prefix, func(rec *Record) {
+		if rec.RevokedAt.IsZero() {
+			rec.RevokedAt = at
+		}
+	})
+}
+
+// TouchLastUsed implements Store. Out-of-order updates from concurrent
+// validations never move LastUsedAt backwards.
+func (s *MemoryStore) TouchLastUsed(ctx context.Context, prefix string, at time.Time) error {
+	return s.update(ctx, prefix, func(rec *Record) {
+		if at.After(rec.LastUsedAt) {
+			rec.LastUsedAt = at
+		}
+	})
+}
+
+// UpdateDigest implements DigestUpdater.
+func (s *MemoryStore) UpdateDigest(ctx context.Context, prefix, digest string) error {
+	return s.update(ctx, prefix, func(rec *Record) { rec.Digest = digest })
+}
+
+// GetBootstrap implements BootstrapStore.
+func (s *MemoryStore) GetBootstrap(ctx context.Context, id string) (BootstrapRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return BootstrapRecord{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.bootstraps[id]
+	if !ok {
+		return BootstrapRecord{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// InsertBootstrap implements BootstrapStore.
+func (s *MemoryStore) InsertBootstrap(ctx context.Context, rec BootstrapRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rec.ID == "" {
+		return bootstrapError(ErrInvalidArgument, "id", "empty id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bootstraps[rec.ID]; ok {
+		return ErrDuplicateID
+	}
+	s.bootstraps[rec.ID] = rec
+	return nil
+}
+
+// ConsumeBootstrap implements BootstrapStore.
+func (s *MemoryStore) ConsumeBootstrap(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.bootstraps[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if rec.Consumed() {
+		return ErrConsumed
+	}
+	rec.ConsumedAt = at
+	s.bootstraps[id] = rec
+	return nil
+}
+
+// DeleteExpired removes every unrevoked API key record that has expired at
+// now, and every bootstrap record that has been consumed or has expired, and
+// returns how many records were removed. Revoked API key records are kept so
+// they keep failing with ErrRevoked rather than ErrNotFound; a removed
+// bootstrap token fails with ErrNotFound instead of ErrConsumed or
+// ErrExpired, and is rejected all the same.
+func (s *MemoryStore) DeleteExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for prefix, rec := range s.records {
+		if rec.Expired(now) && !rec.Revoked() {
+			delete(s.records, prefix)
+			n++
+		}
+	}
+	for id, rec := range s.bootstraps {
+		if rec.Consumed() || rec.Expired(now) {
+			delete(s.bootstraps, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of stored records.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// update applies fn to the record with the given prefix under the write lock.
+func (s *MemoryStore) update(ctx context.Context, prefix string, fn func(*Record)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[prefix]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&rec)
+	s.records[prefix] = rec
+	return nil
+}
@@ -0,0 +1,213 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_CRUD(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := s.GetByPrefix(ctx, "abcd"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Insert(ctx, Record{Prefix: "abcd", Digest: "d", LogbookUID: "lb"}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if err := s.Insert(ctx, Record{Prefix: "abcd"}); !errors.Is(err, ErrDuplicatePrefix) {
+		t.Fatalf("expected ErrDuplicatePrefix, got %v", err)
+	}
+	if err := s.Insert(ctx, Record{Prefix: "NOT-HEX"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+
+	if err := s.TouchLastUsed(ctx, "abcd", t0.Add(2*time.Minute)); err != nil {
+		t.Fatalf("TouchLastUsed error: %v", err)
+	}
+	if err := s.TouchLastUsed(ctx, "abcd", t0.Add(time.Minute)); err != nil {
+		t.Fatalf("TouchLastUsed error: %v", err)
+	}
+	if err := s.Revoke(ctx, "abcd", t0); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	if err := s.Revoke(ctx, "abcd", t0.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	rec, err := s.GetByPrefix(ctx, "abcd")
+	if err != nil {
+		t.Fatalf("GetByPrefix error: %v", err)
+	}
+	if !rec.LastUsedAt.Equal(t0.Add(2 * time.Minute)) {
+		t.Fatalf("LastUsedAt moved backwards: %v", rec.LastUsedAt)
+	}
+	if !rec.RevokedAt.Equal(t0) || !rec.Revoked() {
+		t.Fatalf("expected original revocation time, got %v", rec.RevokedAt)
+	}
+
+	for _, err := range []error{
+		s.Revoke(ctx, "ffff", t0),
+		s.TouchLastUsed(ctx, "ffff", t0),
+		s.UpdateDigest(ctx, "ffff", "d"),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for unknown prefix, got %v", err)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.GetByPrefix(cancelled, "abcd"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMemoryStore_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = s.Insert(ctx, Record{Prefix: "aa", ExpiresAt: now.Add(-time.Second)})
+	_ = s.Insert(ctx, Record{Prefix: "bb", ExpiresAt: now.Add(time.Hour)})
+	_ = s.Insert(ctx, Record{Prefix: "cc"})
+	_ = s.Insert(ctx, Record{Prefix: "dd", ExpiresAt: now.Add(-time.Second), RevokedAt: now.Add(-time.Hour)})
+	_ = s.InsertBootstrap(ctx, BootstrapRecord{ID: "expired", ExpiresAt: now.Add(-time.Second)})
+	_ = s.InsertBootstrap(ctx, BootstrapRecord{ID: "consumed", ExpiresAt: now.Add(time.Hour), ConsumedAt: now.Add(-time.Minute)})
+	_ = s.InsertBootstrap(ctx, BootstrapRecord{ID: "live", ExpiresAt: now.Add(time.Hour)})
+	if n := s.DeleteExpired(now); n != 3 {
+		t.Fatalf("DeleteExpired removed %d records, want 3", n)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("expected 3 records left, got %d", s.Len())
+	}
+	if _, err := s.GetByPrefix(ctx, "dd"); err != nil {
+		t.Fatalf("revoked record should be kept, got %v", err)
+	}
+	for _, id := range []string{"expired", "consumed"} {
+		if _, err := s.GetBootstrap(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("bootstrap %q: expected ErrNotFound, got %v", id, err)
+		}
+	}
+	if _, err := s.GetBootstrap(ctx, "live"); err != nil {
+		t.Fatalf("live bootstrap should be kept, got %v", err)
+	}
+}
+
+// TestMemoryStore_ParallelValidation exercises the store through a Validator
+// from many goroutines while keys are being issued and revoked. Run with
+// -race.
+func TestMemoryStore_ParallelValidation(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	v := NewValidator(s)
+
+	const keys = 8
+	issued := make([]*Key, keys)
+	for i := range issued {
+		k, err := GenerateKey(KeySpec{})
+		if err != nil {
+			t.Fatalf("GenerateKey error: %v", err)
+		}
+		if err := s.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest(), LogbookUID: "lb"}); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+		issued[i] = k
+	}
+	revoked := issued[0]
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64*keys)
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 1; i < keys; i++ {
+				k := issued[(g+i)%(keys-1)+1]
+				if _, err := v.Validate(ctx, k.String()); err != nil {
+					errs <- err
+				}
+			}
+			// the revoked key may or may not be revoked yet, but it must
+			// never fail for any other reason
+			if _, err := v.Validate(ctx, revoked.String()); err != nil && !errors.Is(err, ErrRevoked) {
+				errs <- err
+			}
+		}(g)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := s.Revoke(ctx, revoked.Prefix(), time.Now()); err != nil {
+			errs <- err
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 16; i++ {
+			k, err := GenerateKey(KeySpec{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := s.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest()}); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := v.Validate(ctx, revoked.String()); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected ErrRevoked after revocation, got %v", err)
+	}
+	for _, k := range issued[1:] {
+		rec, err := s.GetByPrefix(ctx, k.Prefix())
+		if err != nil {
+			t.Fatalf("GetByPrefix error: %v", err)
+		}
+		if rec.LastUsedAt.IsZero() {
+			t.Fatalf("expected last-used time for %s", k.Redacted())
+		}
+	}
+}
+
+func TestMemoryStore_Bootstrap(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := s.GetBootstrap(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.InsertBootstrap(ctx, BootstrapRecord{ID: "a", Hash: "h"}); err != nil {
+		t.Fatalf("InsertBootstrap error: %v", err)
+	}
+	if err := s.InsertBootstrap(ctx, BootstrapRecord{ID: "a"}); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("expected ErrDuplicateID, got %v", err)
+	}
+	if err := s.InsertBootstrap(ctx, BootstrapRecord{}); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+	if err := s.ConsumeBootstrap(ctx, "b", t0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.ConsumeBootstrap(ctx, "a", t0); err != nil {
+		t.Fatalf("ConsumeBootstrap error: %v", err)
+	}
+	if err := s.ConsumeBootstrap(ctx, "a", t0.Add(time.Hour)); !errors.Is(err, ErrConsumed) {
+		t.Fatalf("expected ErrConsumed, got %v", err)
+	}
+	rec, err := s.GetBootstrap(ctx, "a")
+	if err != nil || !rec.ConsumedAt.Equal(t0) || rec.Hash != "h" {
+		t.Fatalf("GetBootstrap = %+v, %v", rec, err)
+	}
+	if s.Len() != 0 {
+		t.Fatalf("bootstrap records must not count as API key records")
+	}
+}
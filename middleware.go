@@ -0,0 +1,193 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// AuthScheme is the HTTP authentication scheme clients use to present API
+// keys:
+//
+//	Authorization: ApiKey <key>
+const AuthScheme = "ApiKey"
+
+// XApiKeyHeader is the alternative header accepted by middleware built with
+// WithXApiKeyHeader.
+const XApiKeyHeader = "X-Api-Key"
+
+// DefaultRealm is the realm advertised in WWW-Authenticate challenges unless
+// WithRealm is used.
+const DefaultRealm = "api"
+
+// Authenticator looks up and verifies a presented API key. *Validator
+// implements it; AuthenticatorFunc adapts plain functions, e.g. for tests or
+// custom lookups. Errors should wrap the package's sentinel errors so
+// RequireApiKey can pick a response.
+type Authenticator interface {
+	Validate(ctx context.Context, fullKey string) (Record, error)
+}
+
+var _ Authenticator = (*Validator)(nil)
+
+// AuthenticatorFunc adapts a function to Authenticator.
+type AuthenticatorFunc func(ctx context.Context, fullKey string) (Record, error)
+
+// Validate calls f(ctx, fullKey).
+func (f AuthenticatorFunc) Validate(ctx context.Context, fullKey string) (Record, error) {
+	return f(ctx, fullKey)
+}
+
+// principalKey is the context key for the authenticated Record.
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying rec as the
+// authenticated principal.
+func ContextWithPrincipal(ctx context.Context, rec Record) context.Context {
+	return context.WithValue(ctx, principalKey{}, rec)
+}
+
+// PrincipalFromContext returns the Record stored by RequireApiKey (or
+// ContextWithPrincipal), and false when the request was not authenticated.
+func PrincipalFromContext(ctx context.Context) (Record, bool) {
+	rec, ok := ctx.Value(principalKey{}).(Record)
+	return rec, ok
+}
+
+// middleware holds the configuration built by MiddlewareOptions.
+type middleware struct {
+	auth      Authenticator
+	realm     string
+	xApiKey   bool
+	challenge string
+}
+
+// MiddlewareOption configures RequireApiKey.
+type MiddlewareOption interface {
+	applyMiddleware(*middleware)
+}
+
+// middlewareOptionFunc adapts a function to MiddlewareOption.
+type middlewareOptionFunc func(*middleware)
+
+func (f middlewareOptionFunc) applyMiddleware(m *middleware) { f(m) }
+
+// WithRealm sets the realm advertised in WWW-Authenticate challenges. It
+// defaults to DefaultRealm.
+func WithRealm(realm string) MiddlewareOption {
+	return middlewareOptionFunc(func(m *middleware) { m.realm = realm })
+}
+
+// WithXApiKeyHeader makes the middleware also accept the key in the
+// X-Api-Key header, for clients that cannot set Authorization.
+func WithXApiKeyHeader() MiddlewareOption {
+	return middlewareOptionFunc(func(m *middleware) { m.xApiKey = true })
+}
+
+// RequireApiKey returns middleware that authenticates every request with
+// auth before calling the next handler. The key is read from an
+// "Authorization: ApiKey <key>" header (the scheme is case-insensitive) and,
+// with WithXApiKeyHeader, from X-Api-Key. On success the Record is available
+// to next through PrincipalFromContext.
+//
+// Failures are answered in the style of RFC 6750 section 3:
+//
+//   - no key: 401 with a bare challenge,
+//   - an unparsable header, or conflicting keys in both headers: 400 with
+//     error="invalid_request",
+//   - a malformed, unknown, wrong, revoked or expired key: 401 with
+//     error="invalid_token",
+//   - a key whose kind is not allowed: 403 with error="insufficient_scope",
+//   - any other error, such as a storage failure: 500 without a challenge.
+//
+// Error descriptions never include the presented key.
+func RequireApiKey(auth Authenticator, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	m := &middleware{auth: auth, realm: DefaultRealm}
+	for _, opt := range opts {
+		opt.applyMiddleware(m)
+	}
+	m.challenge = AuthScheme + ` realm="` + quoteEscape(m.realm) + `"`
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := m.extract(r)
+			if !ok {
+				m.fail(w, http.StatusBadRequest, "invalid_request", "malformed api key credentials")
+				return
+			}
+			if key == "" {
+				w.Header().Set("WWW-Authenticate", m.challenge)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			rec, err := m.auth.Validate(r.Context(), key)
+			if err != nil {
+				m.reject(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), rec)))
+		})
+	}
+}
+
+// extract returns the presented key, or "" when there is none. ok is false
+// when the credentials are present but unusable.
+func (m *middleware) extract(r *http.Request) (key string, ok bool) {
+	authz := r.Header.Values("Authorization")
+	if len(authz) > 1 {
+		return "", false
+	}
+	if len(authz) == 1 {
+		scheme, param, found := strings.Cut(authz[0], " ")
+		if strings.EqualFold(scheme, AuthScheme) {
+			key = strings.TrimSpace(param)
+			if !found || key == "" || strings.ContainsAny(key, " \t") {
+				return "", false
+			}
+		}
+	}
+	if !m.xApiKey {
+		return key, true
+	}
+	xs := r.Header.Values(XApiKeyHeader)
+	if len(xs) > 1 {
+		return "", false
+	}
+	if len(xs) == 1 {
+		x := strings.TrimSpace(xs[0])
+		if x == "" || (key != "" && x != key) {
+			return "", false
+		}
+		key = x
+	}
+	return key, true
+}
+
+// reject maps a Validate error to a response.
+func (m *middleware) reject(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrKindNotAllowed):
+		m.fail(w, http.StatusForbidden, "insufficient_scope", "api key kind not allowed")
+	case errors.Is(err, ErrExpired):
+		m.fail(w, http.StatusUnauthorized, "invalid_token", "api key expired")
+	case errors.Is(err, ErrRevoked):
+		m.fail(w, http.StatusUnauthorized, "invalid_token", "api key revoked")
+	case errors.Is(err, ErrEmpty), errors.Is(err, ErrMalformed), errors.Is(err, ErrChecksumMismatch),
+		errors.Is(err, ErrNotFound), errors.Is(err, ErrMismatch):
+		m.fail(w, http.StatusUnauthorized, "invalid_token", "invalid api key")
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// fail writes status with a challenge carrying code and description.
+func (m *middleware) fail(w http.ResponseWriter, status int, code, desc string) {
+	w.Header().Set("WWW-Authenticate",
+		m.challenge+`, error="`+code+`", error_description="`+desc+`"`)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// quoteEscape escapes s for use inside an HTTP quoted-string.
+func quoteEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,118 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMiddleware(t *testing.T, opts ...MiddlewareOption) (http.Handler, *Key, *Key) {
+	t.Helper()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := NewValidator(store, WithClock(func() time.Time { return now }), WithAllowedKinds(KindUnspecified, KindLive))
+
+	insert := func(spec KeySpec, rec Record) *Key {
+		k, err := GenerateKey(spec)
+		if err != nil {
+			t.Fatalf("GenerateKey error: %v", err)
+		}
+		rec.Prefix, rec.Digest, rec.CreatedAt = k.Prefix(), k.Digest(), now
+		if err := store.Insert(ctx, rec); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+		return k
+	}
+	good := insert(KeySpec{PrefixLen: 12}, Record{LogbookUID: "lb-1"})
+	revoked := insert(KeySpec{PrefixLen: 12}, Record{LogbookUID: "lb-2", RevokedAt: now})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			t.Errorf("no principal in context")
+		}
+		_, _ = w.Write([]byte(rec.LogbookUID))
+	})
+	return RequireApiKey(v, opts...)(next), good, revoked
+}
+
+func serve(h http.Handler, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/qso", nil)
+	for name, vals := range header {
+		for _, v := range vals {
+			req.Header.Add(name, v)
+		}
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRequireApiKey(t *testing.T) {
+	h, good, revoked := newTestMiddleware(t, WithXApiKeyHeader(), WithRealm(`qso "uploads"`))
+	test, _ := GenerateKey(KeySpec{Kind: KindTest})
+
+	cases := []struct {
+		name      string
+		header    http.Header
+		status    int
+		challenge string
+	}{
+		{"authorization", http.Header{"Authorization": {"ApiKey " + good.String()}}, http.StatusOK, ""},
+		{"scheme case", http.Header{"Authorization": {"apikey " + good.String()}}, http.StatusOK, ""},
+		{"x-api-key", http.Header{"X-Api-Key": {good.String()}}, http.StatusOK, ""},
+		{"both equal", http.Header{"Authorization": {"ApiKey " + good.String()}, "X-Api-Key": {good.String()}}, http.StatusOK, ""},
+		{"missing", nil, http.StatusUnauthorized, `ApiKey realm="qso \"uploads\""`},
+		{"other scheme", http.Header{"Authorization": {"Bearer abc"}}, http.StatusUnauthorized, `ApiKey realm="qso \"uploads\""`},
+		{"no credentials", http.Header{"Authorization": {"ApiKey"}}, http.StatusBadRequest, `error="invalid_request"`},
+		{"both differ", http.Header{"Authorization": {"ApiKey " + good.String()}, "X-Api-Key": {revoked.String()}}, http.StatusBadRequest, `error="invalid_request"`},
+		{"malformed", http.Header{"Authorization": {"ApiKey nope"}}, http.StatusUnauthorized, `error="invalid_token", error_description="invalid api key"`},
+		{"revoked", http.Header{"Authorization": {"ApiKey " + revoked.String()}}, http.StatusUnauthorized, `error_description="api key revoked"`},
+		{"kind", http.Header{"Authorization": {"ApiKey " + test.String()}}, http.StatusForbidden, `error="insufficient_scope"`},
+	}
+	for _, tc := range cases {
+		rr := serve(h, tc.header)
+		if rr.Code != tc.status {
+			t.Fatalf("%s: status = %d, want %d", tc.name, rr.Code, tc.status)
+		}
+		got := rr.Header().Get("WWW-Authenticate")
+		if tc.status == http.StatusOK {
+			if got != "" || rr.Body.String() != "lb-1" {
+				t.Fatalf("%s: unexpected response %q, challenge %q", tc.name, rr.Body.String(), got)
+			}
+			continue
+		}
+		if !strings.HasPrefix(got, `ApiKey realm="qso \"uploads\""`) || !strings.Contains(got, tc.challenge) {
+			t.Fatalf("%s: WWW-Authenticate = %q, want it to contain %q", tc.name, got, tc.challenge)
+		}
+		if strings.Contains(got, good.Secret()) || strings.Contains(got, revoked.Secret()) {
+			t.Fatalf("%s: challenge leaks the secret", tc.name)
+		}
+	}
+}
+
+func TestRequireApiKey_XApiKeyDisabled(t *testing.T) {
+	h, good, _ := newTestMiddleware(t)
+	rr := serve(h, http.Header{"X-Api-Key": {good.String()}})
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") != `ApiKey realm="api"` {
+		t.Fatalf("X-Api-Key accepted without WithXApiKeyHeader: %d %q", rr.Code, rr.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestRequireApiKey_InternalError(t *testing.T) {
+	auth := AuthenticatorFunc(func(context.Context, string) (Record, error) {
+		return Record{}, errors.New("database unavailable")
+	})
+	h := RequireApiKey(auth)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Fatalf("next handler called on error")
+	}))
+	rr := serve(h, http.Header{"Authorization": {"ApiKey abc_def"}})
+	if rr.Code != http.StatusInternalServerError || rr.Header().Get("WWW-Authenticate") != "" {
+		t.Fatalf("status = %d, challenge = %q", rr.Code, rr.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,119 @@
+package apikey
+
+import (
+	"strings"
+	"unicode"
+)
+
+// symbolLookalikes maps characters excluded from userFriendlyAlphabet to the
+// symbol they are most often mistaken for. Generated secrets never contain
+// the excluded characters, so the mapping only has to be stable: a wrong
+// guess still fails the checksum or digest comparison.
+var symbolLookalikes = map[rune]rune{
+	'0': 'D',
+	'O': 'D',
+	'1': 'J',
+	'I': 'J',
+	'L': 'J',
+}
+
+// hexLookalikes maps letters commonly typed for hex digits.
+var hexLookalikes = map[rune]rune{
+	'o': '0',
+	'i': '1',
+	'l': '1',
+}
+
+// NormalizeApiKey rewrites a key as typed by a person into its canonical
+// form. It
+//
+//   - removes whitespace and invisible formatting characters,
+//   - replaces Unicode dashes (en dash, em dash, minus sign, ...) with "-",
+//   - lower-cases the vendor tag, kind and prefix, and maps o, i and l in the
+//     prefix to 0, 1 and 1,
+//   - upper-cases the secret and checksum, maps the look-alikes O and 0 to D
+//     and I, L and 1 to J, and regroups the secret's dashes.
+//
+// Legacy FormatV0 keys are lower-cased with the same hex look-alikes mapped.
+// NormalizeApiKey does not validate: a key that is malformed before
+// normalisation generally stays malformed. ParseApiKey and ParseKey normalise
+// before parsing, so the secret they return, and thus its digest, does not
+// depend on how the key was typed.
+func NormalizeApiKey(fullKey string) string {
+	s := cleanKey(fullKey)
+	if detectFormat(s) == FormatV0 {
+		prefix, secret, _ := strings.Cut(s, legacySeparator)
+		return normalizeHex(prefix) + legacySeparator + normalizeHex(secret)
+	}
+	return defaultLayout.normalize(s)
+}
+
+// cleanKey removes whitespace and invisible formatting characters from s and
+// replaces Unicode dashes with groupDash.
+func cleanKey(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r) || unicode.Is(unicode.Cf, r):
+		case unicode.Is(unicode.Pd, r) || r == '−':
+			sb.WriteByte(groupDash)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// normalize applies the segment rules of NormalizeApiKey to a cleaned key
+// written with l. Secrets and checksums are only upper-cased when l's
+// alphabet has no lowercase letters, and look-alikes are only mapped to
+// symbols of the alphabet.
+func (l *layout) normalize(s string) string {
+	segs := strings.Split(s, l.sep)
+	if len(segs) < 2 {
+		return s
+	}
+	// The secret is the second segment of "<prefix>_<secret>" and the one
+	// before the checksum in every longer layout.
+	sec := len(segs) - 2
+	if len(segs) == 2 {
+		sec = 1
+	}
+	for i, seg := range segs {
+		switch {
+		case i < sec-1:
+			segs[i] = strings.ToLower(seg)
+		case i == sec-1:
+			segs[i] = normalizeHex(seg)
+		case i == sec:
+			segs[i] = l.group(l.normalizeSymbols(strings.ReplaceAll(seg, string(groupDash), "")))
+		default:
+			segs[i] = l.normalizeSymbols(seg)
+		}
+	}
+	return strings.Join(segs, l.sep)
+}
+
+// normalizeHex lower-cases s and maps hexLookalikes.
+func normalizeHex(s string) string {
+	return strings.Map(func(r rune) rune {
+		if m, ok := hexLookalikes[r]; ok {
+			return m
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// normalizeSymbols upper-cases s, unless the alphabet has lowercase letters,
+// and maps symbolLookalikes that are not themselves in the alphabet.
+func (l *layout) normalizeSymbols(s string) string {
+	if strings.ToUpper(l.alphabet) == l.alphabet {
+		s = strings.ToUpper(s)
+	}
+	return strings.Map(func(r rune) rune {
+		if m, ok := symbolLookalikes[r]; ok && !strings.ContainsRune(l.alphabet, r) && strings.ContainsRune(l.alphabet, m) {
+			return m
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,67 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeApiKey(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"abcd12_ABCD-EFGH-JKMN-PQRS-TUVW", "abcd12_ABCD-EFGH-JKMN-PQRS-TUVW"},
+		{" ABCD12_abcd efgh jkmn pqrs tuvw\n", "abcd12_ABCD-EFGH-JKMN-PQRS-TUVW"},
+		{"abcd12_ABCD–EFGH—JKMN−PQRS‐TUVW", "abcd12_ABCD-EFGH-JKMN-PQRS-TUVW"},
+		{"abcd12_ABCDEFGHJKMNPQRSTUVW", "abcd12_ABCD-EFGH-JKMN-PQRS-TUVW"},
+		{"abcd12_AB-CDEF-GHJKMN-PQRSTU-VW", "abcd12_ABCD-EFGH-JKMN-PQRS-TUVW"},
+		{"abcd12_0BCD-OFGH-1KMN-IQRS-LUVW", "abcd12_DBCD-DFGH-JKMN-JQRS-JUVW"},
+		{"aBcDoI_ABCD-EFGH-JKMN-PQRS-TUVW_x0y1z2", "abcd01_ABCD-EFGH-JKMN-PQRS-TUVW_XDYJZ2"},
+		{"SMK_LIVE_abcd12_ABCD-EFGH-JKMN-PQRS-TUVW_XYZ234", "smk_live_abcd12_ABCD-EFGH-JKMN-PQRS-TUVW_XYZ234"},
+		{"ABCD12." + strings.Repeat("AB", 31) + "Ol", "abcd12." + strings.Repeat("ab", 31) + "01"},
+		{"\u200babcd12_abcd-efgh-jkmn-pqrs-tuvw\ufeff", "abcd12_ABCD-EFGH-JKMN-PQRS-TUVW"},
+		{"nosecret", "nosecret"},
+	}
+	for _, tc := range cases {
+		if got := NormalizeApiKey(tc.in); got != tc.want {
+			t.Fatalf("NormalizeApiKey(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseApiKey_Normalizes(t *testing.T) {
+	k, err := GenerateKey(KeySpec{PrefixLen: 12, Vendor: "stnmgr", Kind: KindLive})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	typed := strings.ToLower(strings.ReplaceAll(k.String(), "-", " – "))
+	typed = strings.Replace(typed, k.Vendor(), strings.ToUpper(k.Vendor()), 1)
+	parsed, err := ParseKey(typed)
+	if err != nil {
+		t.Fatalf("ParseKey(%q) error: %v", typed, err)
+	}
+	if *parsed != *k {
+		t.Fatalf("normalised key mismatch: got %+v, want %+v", *parsed, *k)
+	}
+	ok, err := ValidateApiKey(typed, k.Digest())
+	if err != nil || !ok {
+		t.Fatalf("ValidateApiKey on typed key ok=%v err=%v", ok, err)
+	}
+}
+
+func TestParseApiKey_LookalikeFailsChecksum(t *testing.T) {
+	k, err := GenerateKey(KeySpec{PrefixLen: 12, Checksum: true})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	// replace a symbol with a look-alike that maps elsewhere
+	s := k.String()
+	i := strings.Index(s, separator) + 1
+	if s[i] == 'D' {
+		s = s[:i] + "L" + s[i+1:]
+	} else {
+		s = s[:i] + "0" + s[i+1:]
+	}
+	if _, err := ParseKey(s); err == nil {
+		t.Fatalf("expected checksum failure for %q", s)
+	}
+}
@@ -0,0 +1,148 @@
+package apikey
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+// RandOption is an option accepted by NewGenerator, NewPasswordHasher and
+// NewBootstrapIssuer.
+type RandOption interface {
+	GeneratorOption
+	PasswordHasherOption
+	BootstrapIssuerOption
+}
+
+// randOption implements RandOption.
+type randOption struct {
+	r io.Reader
+}
+
+func (o randOption) applyGenerator(g *Generator)             { g.rand = o.r }
+func (o randOption) applyPasswordHasher(h *PasswordHasher)   { h.rand = o.r }
+func (o randOption) applyBootstrapIssuer(b *BootstrapIssuer) { b.rand = o.r }
+
+// WithRand sets the source of randomness for secrets, prefixes and salts. It
+// defaults to crypto/rand.Reader and should only be replaced in tests, e.g.
+// with a seeded reader for golden-file tests or a failing reader to exercise
+// error paths. Reads that fail or come up short abort the operation.
+func WithRand(r io.Reader) RandOption {
+	return randOption{r: r}
+}
+
+// ClockOption is an option accepted by NewValidator and NewBootstrapIssuer.
+type ClockOption interface {
+	ValidatorOption
+	BootstrapIssuerOption
+}
+
+// clockOption implements ClockOption.
+type clockOption struct {
+	now func() time.Time
+}
+
+func (o clockOption) applyValidator(v *Validator)             { v.now = o.now }
+func (o clockOption) applyBootstrapIssuer(b *BootstrapIssuer) { b.now = o.now }
+
+// WithClock sets the time source used for expiry checks, expiry times and
+// last-used tracking. It defaults to time.Now.
+func WithClock(now func() time.Time) ClockOption {
+	return clockOption{now: now}
+}
+
+// KeyringOption is an option accepted by NewValidator and
+// NewBootstrapIssuer.
+type KeyringOption interface {
+	ValidatorOption
+	BootstrapIssuerOption
+}
+
+// keyringOption implements KeyringOption.
+type keyringOption struct {
+	kr *Keyring
+}
+
+func (o keyringOption) applyValidator(v *Validator)             { v.keyring = o.kr }
+func (o keyringOption) applyBootstrapIssuer(b *BootstrapIssuer) { b.keyring = o.kr }
+
+// WithKeyring supplies the peppers for keyed digests.
+//
+// A Validator checks keyed API key digests with kr and upgrades outdated
+// digests when the Store implements DigestUpdater. Without a keyring only
+// unkeyed SHA-512 digests can be validated.
+//
+// A BootstrapIssuer stores an HMAC of each new secret under kr's current
+// pepper, "$<alg>$v=2$k=<id>$<hex>", instead of an Argon2id hash. The HMAC
+// input is domain-separated, so the same keyring can serve both without a
+// bootstrap hash ever validating as an API key digest. Bootstrap
+// secrets carry 256 bits of entropy, so a slow hash adds no protection
+// against guessing, while the HMAC keeps validation cheap for
+// unauthenticated callers; a Keyring created with DigestHMACSHA256 is the
+// intended choice. The issuer still validates Argon2id hashes it stored
+// before the keyring was configured.
+func WithKeyring(kr *Keyring) KeyringOption {
+	return keyringOption{kr: kr}
+}
+
+// LoggerOption is an option accepted by NewGenerator, NewValidator,
+// NewPasswordHasher and NewBootstrapIssuer.
+type LoggerOption interface {
+	GeneratorOption
+	ValidatorOption
+	PasswordHasherOption
+	BootstrapIssuerOption
+}
+
+// loggerOption implements LoggerOption.
+type loggerOption struct {
+	log *slog.Logger
+}
+
+func (o loggerOption) applyGenerator(g *Generator)             { g.log = o.log }
+func (o loggerOption) applyValidator(v *Validator)             { v.log = o.log }
+func (o loggerOption) applyPasswordHasher(h *PasswordHasher)   { h.log = o.log }
+func (o loggerOption) applyBootstrapIssuer(b *BootstrapIssuer) { b.log = o.log }
+
+// WithLogger sets the logger that receives events for generation,
+// successful and failed validation and parameter upgrades. Events carry
+// prefixes, kinds and error reasons but never secrets, passwords or
+// digests. By default nothing is logged; a nil logger also disables
+// logging.
+func WithLogger(log *slog.Logger) LoggerOption {
+	if log == nil {
+		log = discardLogger
+	}
+	return loggerOption{log: log}
+}
+
+// discardLogger is the default logger of every configurable type.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Argon2Option is an option accepted by NewPasswordHasher and
+// NewBootstrapIssuer.
+type Argon2Option interface {
+	PasswordHasherOption
+	BootstrapIssuerOption
+}
+
+// argon2Option implements Argon2Option.
+type argon2Option struct {
+	params argonParams
+}
+
+func (o argon2Option) applyPasswordHasher(h *PasswordHasher) {
+	h.params = o.params.orDefault(h.params)
+}
+
+func (o argon2Option) applyBootstrapIssuer(b *BootstrapIssuer) {
+	b.params = o.params.orDefault(b.params)
+}
+
+// WithArgon2Params sets the Argon2id cost of new hashes: time is the number
+// of passes, memory is in KiB and threads is the parallelism. Zero values
+// keep the respective default. The parameters are stored in each hash, so
+// changing them does not invalidate existing hashes.
+func WithArgon2Params(time, memory uint32, threads uint8) Argon2Option {
+	return argon2Option{params: argonParams{memory: memory, time: time, parallel: threads}}
+}
@@ -0,0 +1,165 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func seeded(b byte) *rand.ChaCha8 {
+	var seed [32]byte
+	seed[0] = b
+	return rand.NewChaCha8(seed)
+}
+
+func TestWithRand_Deterministic(t *testing.T) {
+	keys := make([]string, 3)
+	for i, seed := range []byte{1, 1, 2} {
+		g, err := NewGenerator(WithRand(seeded(seed)), WithChecksum())
+		if err != nil {
+			t.Fatalf("NewGenerator error: %v", err)
+		}
+		k, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Generate error: %v", err)
+		}
+		keys[i] = k.String()
+	}
+	if keys[0] != keys[1] || keys[0] == keys[2] {
+		t.Fatalf("keys should depend only on the seed: %q", keys)
+	}
+
+	h1, err := NewPasswordHasher(WithRand(seeded(1))).Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	h2, _ := NewPasswordHasher(WithRand(seeded(1))).Hash("hunter2")
+	if h1 != h2 {
+		t.Fatalf("password hashes should depend only on the seed")
+	}
+
+	p1, s1, _, err := NewBootstrapIssuer(WithRand(seeded(1))).Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	p2, s2, _, _ := NewBootstrapIssuer(WithRand(seeded(1))).Generate()
+	if p1 != p2 || s1 != s2 {
+		t.Fatalf("bootstrap tokens should depend only on the seed")
+	}
+}
+
+func TestWithRand_Failure(t *testing.T) {
+	errEntropy := errors.New("entropy exhausted")
+
+	g, err := NewGenerator(WithRand(iotest.ErrReader(errEntropy)))
+	if err != nil {
+		t.Fatalf("NewGenerator error: %v", err)
+	}
+	if k, err := g.Generate(); !errors.Is(err, errEntropy) || k != nil {
+		t.Fatalf("Generate = %v, %v; want entropy error", k, err)
+	}
+
+	if h, err := NewPasswordHasher(WithRand(iotest.ErrReader(errEntropy))).Hash("hunter2"); !errors.Is(err, errEntropy) || h != "" {
+		t.Fatalf("Hash = %q, %v; want entropy error", h, err)
+	}
+
+	// the secret reads fine, the salt does not
+	r := io.MultiReader(io.LimitReader(seeded(1), 32), iotest.ErrReader(errEntropy))
+	plain, hash, expires, err := NewBootstrapIssuer(WithRand(r)).Generate()
+	if !errors.Is(err, errEntropy) || plain != "" || hash != "" || !expires.IsZero() {
+		t.Fatalf("Generate = %q, %q, %v, %v; want zero values and entropy error", plain, hash, expires, err)
+	}
+}
+
+func TestWithLogger_Events(t *testing.T) {
+	var buf bytes.Buffer
+	log := WithLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	ctx := context.Background()
+
+	g, err := NewGenerator(log)
+	if err != nil {
+		t.Fatalf("NewGenerator error: %v", err)
+	}
+	k, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	kr, _ := NewKeyring(DigestHMACSHA512)
+	_ = kr.Add("k1", testPepper)
+	_ = kr.SetCurrent("k1")
+	store := NewMemoryStore()
+	if err := store.Insert(ctx, Record{Prefix: k.Prefix(), Digest: legacyDigest(k.Secret()), CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	v := NewValidator(store, WithKeyring(kr), log)
+	if _, err := v.Validate(ctx, k.String()); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	wrong := k.Prefix() + separator + strings.Repeat("A", SecretSymbolLen)
+	if _, err := v.Validate(ctx, wrong); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+
+	h := NewPasswordHasher(log)
+	phc, err := h.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	if ok, err := h.Verify(phc, "hunter2"); !ok || err != nil {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+	salt := []byte("0123456789abcdef")
+	weak := "$argon2id$v=19$m=65536,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("hunter2"), salt, 1, 64*1024, 1, 32))
+	if _, err := h.Verify(weak, "hunter2"); err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+
+	b := NewBootstrapIssuer(log)
+	plain, stored, expires, err := b.Generate()
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if ok, err := b.Validate(plain, stored, expires); !ok || err != nil {
+		t.Fatalf("Validate = %v, %v", ok, err)
+	}
+
+	out := buf.String()
+	for _, msg := range []string{
+		"api key generated", "api key digest upgraded", "api key validated", "api key rejected",
+		"password hashed", "password verified", "password hash parameters outdated",
+		"bootstrap generated", "bootstrap validated",
+	} {
+		if !strings.Contains(out, `"msg":"`+msg+`"`) {
+			t.Fatalf("missing %q event in log:\n%s", msg, out)
+		}
+	}
+	for _, secret := range []string{k.Secret(), canonicalSecret(k.Secret()), k.String(), "hunter2", plain, stored, phc} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("log leaks a secret:\n%s", out)
+		}
+	}
+	if !strings.Contains(out, k.Redacted()) {
+		t.Fatalf("log should identify keys by their redacted form:\n%s", out)
+	}
+}
+
+func TestWithLogger_Nil(t *testing.T) {
+	g, err := NewGenerator(WithLogger(nil))
+	if err != nil {
+		t.Fatalf("NewGenerator error: %v", err)
+	}
+	if _, err := g.Generate(); err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+}
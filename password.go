@@ -2,14 +2,10 @@ package apikey
 
 import (
 	"crypto/rand"
-	"crypto/subtle"
-	"encoding/base64"
-	"errors"
 	"fmt"
-	"strconv"
+	"io"
+	"log/slog"
 	"strings"
-
-	"golang.org/x/crypto/argon2"
 )
 
 // Argon2id parameters (sane defaults for interactive logins)
@@ -21,6 +17,33 @@ const (
 	argonKeyLen          = 32        // bytes
 )
 
+// passwordArgonParams are the parameters PasswordHasher uses unless
+// WithArgon2Params is given.
+var passwordArgonParams = argonParams{memory: argonMemory, time: argonTime, parallel: argonParallel}
+
+// PasswordHasher derives Argon2id password hashes. Use NewPasswordHasher to
+// create one; HashPassword uses a PasswordHasher with default settings.
+type PasswordHasher struct {
+	rand   io.Reader
+	log    *slog.Logger
+	params argonParams
+}
+
+// PasswordHasherOption configures a PasswordHasher.
+type PasswordHasherOption interface {
+	applyPasswordHasher(*PasswordHasher)
+}
+
+// NewPasswordHasher returns a PasswordHasher configured by opts. Salts are
+// read from crypto/rand unless WithRand is given.
+func NewPasswordHasher(opts ...PasswordHasherOption) *PasswordHasher {
+	h := &PasswordHasher{rand: rand.Reader, log: discardLogger, params: passwordArgonParams}
+	for _, opt := range opts {
+		opt.applyPasswordHasher(h)
+	}
+	return h
+}
+
 // HashPassword derives an Argon2id hash for the provided password and returns
 // a PHC-formatted string:
 //
@@ -29,17 +52,22 @@ const (
 // The returned string contains only ASCII characters and is safe for
 // storage in TEXT/VARCHAR columns.
 func HashPassword(password string) (string, error) {
+	return NewPasswordHasher().Hash(password)
+}
+
+// Hash behaves like HashPassword, reading the salt from h's randomness
+// source. A failing read is returned wrapped.
+func (h *PasswordHasher) Hash(password string) (string, error) {
 	if strings.TrimSpace(password) == "" {
-		return "", errors.New("password cannot be empty")
+		return "", passwordError(ErrEmpty, "", "password cannot be empty")
 	}
 	salt := make([]byte, argonSaltLen)
-	if _, err := rand.Read(salt); err != nil {
-		return "", fmt.Errorf("rand.Read: %w", err)
+	if _, err := io.ReadFull(h.rand, salt); err != nil {
+		h.log.Error("password hashing failed", slog.Any("err", err))
+		return "", fmt.Errorf("read salt: %w", err)
 	}
-	h := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonParallel, argonKeyLen)
-	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
-	b64Hash := base64.RawStdEncoding.EncodeToString(h)
-	phc := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", argonMemory, argonTime, argonParallel, b64Salt, b64Hash)
+	phc := newArgonHash([]byte(password), salt, h.params, argonKeyLen).String()
+	h.log.Info("password hashed", slog.Any("params", h.params))
 	return phc, nil
 }
 
@@ -47,66 +75,30 @@ func HashPassword(password string) (string, error) {
 // Returns true if it matches, false otherwise. The phc parameter is expected
 // to be the encoded string returned from HashPassword.
 func VerifyPassword(phc, password string) (bool, error) {
-	if !strings.HasPrefix(phc, "$argon2id$") {
-		return false, errors.New("unsupported hash format")
-	}
-	parts := strings.Split(phc, "$")
-	// parts: ["", "argon2id", "v=19", "m=..,t=..,p=..", "<salt>", "<hash>"]
-	if len(parts) != 6 {
-		return false, errors.New("invalid phc format")
-	}
-	versionPart := parts[2]
-	if versionPart != "v=19" {
-		return false, errors.New("unsupported argon2 version")
-	}
-	paramPart := parts[3]
-	var mem uint32
-	var time uint32
-	var par uint8
-	for _, kv := range strings.Split(paramPart, ",") {
-		kvp := strings.SplitN(kv, "=", 2)
-		if len(kvp) != 2 {
-			return false, errors.New("invalid argon2 params")
-		}
-		switch kvp[0] {
-		case "m":
-			mv, err := strconv.ParseUint(kvp[1], 10, 32)
-			if err != nil {
-				return false, err
-			}
-			mem = uint32(mv)
-		case "t":
-			iv, err := strconv.ParseUint(kvp[1], 10, 32)
-			if err != nil {
-				return false, err
-			}
-			time = uint32(iv)
-		case "p":
-			pv, err := strconv.ParseUint(kvp[1], 10, 8)
-			if err != nil {
-				return false, err
-			}
-			par = uint8(pv)
-		default:
-			return false, errors.New("unknown argon2 param")
-		}
-	}
-	saltB64 := parts[4]
-	hashB64 := parts[5]
-	salt, err := base64.RawStdEncoding.DecodeString(saltB64)
+	h, err := parseArgonHash(phc, passwordError)
 	if err != nil {
-		return false, fmt.Errorf("decode salt: %w", err)
+		return false, err
 	}
-	want, err := base64.RawStdEncoding.DecodeString(hashB64)
+	return h.matches([]byte(password)), nil
+}
+
+// Verify behaves like VerifyPassword and logs the outcome. A matching hash
+// whose parameters differ from those Hash uses is logged as due for an
+// upgrade; callers should then store a fresh Hash of password.
+func (h *PasswordHasher) Verify(phc, password string) (bool, error) {
+	stored, err := parseArgonHash(phc, passwordError)
 	if err != nil {
-		return false, fmt.Errorf("decode hash: %w", err)
+		h.log.Warn("password verification failed", slog.Any("err", err))
+		return false, err
 	}
-	got := argon2.IDKey([]byte(password), salt, time, mem, par, uint32(len(want)))
-	if len(got) != len(want) {
+	switch {
+	case !stored.matches([]byte(password)):
+		h.log.Info("password rejected")
 		return false, nil
+	case stored.argonParams != h.params:
+		h.log.Info("password hash parameters outdated", slog.Any("params", stored.argonParams), slog.Any("want", h.params))
+	default:
+		h.log.Debug("password verified")
 	}
-	if subtle.ConstantTimeCompare(got, want) == 1 {
-		return true, nil
-	}
-	return false, nil
+	return true, nil
 }
@@ -1,6 +1,11 @@
 package apikey
 
-import "testing"
+import (
+	"crypto/rand"
+	"math"
+	"strings"
+	"testing"
+)
 
 // TestGenerateIndependentPrefixSanity checks, with overwhelming probability,
 // that the generated prefix is independent of the secret.
@@ -39,3 +44,65 @@ func TestGenerateIndependentPrefixSanity(t *testing.T) {
 		t.Fatalf("prefix appears derived from secret: observed %d match(es) where prefix == secret[:%d]", matches, N)
 	}
 }
+
+// chiSquareUniform returns Pearson's chi-square statistic for the symbol
+// counts in s against a uniform distribution over alphabet.
+func chiSquareUniform(s, alphabet string) float64 {
+	counts := make(map[byte]int, len(alphabet))
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	expected := float64(len(s)) / float64(len(alphabet))
+	var chi2 float64
+	for i := 0; i < len(alphabet); i++ {
+		d := float64(counts[alphabet[i]]) - expected
+		chi2 += d * d / expected
+	}
+	return chi2
+}
+
+// chiSquareLimit is the rejection threshold for 30 degrees of freedom (31
+// symbols). A uniform source exceeds it with probability below 1e-4, while the
+// old "byte % 31" mapping scores around 280 at the sample size used below.
+const chiSquareLimit = 70.0
+
+// TestRandomSymbolsUnbiased checks that secret symbols are uniformly
+// distributed over userFriendlyAlphabet.
+func TestRandomSymbolsUnbiased(t *testing.T) {
+	const samples = 100000
+	s, err := randomSymbols(rand.Reader, userFriendlyAlphabet, samples)
+	if err != nil {
+		t.Fatalf("randomSymbols failed: %v", err)
+	}
+	if len(s) != samples {
+		t.Fatalf("expected %d symbols, got %d", samples, len(s))
+	}
+	if chi2 := chiSquareUniform(s, userFriendlyAlphabet); chi2 > chiSquareLimit {
+		t.Fatalf("symbol distribution looks biased: chi2=%.1f > %.1f", chi2, chiSquareLimit)
+	}
+}
+
+// TestChiSquareDetectsModuloBias makes sure the statistic above is sensitive
+// enough to catch the naive "byte % len(alphabet)" mapping.
+func TestChiSquareDetectsModuloBias(t *testing.T) {
+	const samples = 100000
+	b := make([]byte, samples)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("rand.Read failed: %v", err)
+	}
+	var sb strings.Builder
+	for _, v := range b {
+		sb.WriteByte(userFriendlyAlphabet[int(v)%len(userFriendlyAlphabet)])
+	}
+	if chi2 := chiSquareUniform(sb.String(), userFriendlyAlphabet); chi2 <= chiSquareLimit {
+		t.Fatalf("biased mapping went undetected: chi2=%.1f <= %.1f", chi2, chiSquareLimit)
+	}
+}
+
+// TestSecretEntropyBits verifies the documented entropy of a generated secret.
+func TestSecretEntropyBits(t *testing.T) {
+	bits := float64(SecretSymbolLen) * math.Log2(float64(len(userFriendlyAlphabet)))
+	if int(math.Floor(bits)) != SecretEntropyBits {
+		t.Fatalf("SecretEntropyBits=%d, computed %.2f", SecretEntropyBits, bits)
+	}
+}
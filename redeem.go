@@ -0,0 +1,212 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// BootstrapRecord is the server-side state of a bootstrap token. It never
+// holds the token, only its hash.
+type BootstrapRecord struct {
+	// ID identifies the token and is presented alongside it, e.g. the
+	// account or provisioning request the token was issued for.
+	ID string
+	// LogbookUID is the logbook the token provisions, as given to Issue.
+	// Exchange binds the API key it issues to it.
+	LogbookUID string
+	// Hash is the stored hash of the token, as returned by
+	// BootstrapIssuer.Generate.
+	Hash string
+	// CreatedAt is when the token was issued.
+	CreatedAt time.Time
+	// ExpiresAt is when the token stops being valid. The zero value means the
+	// token never expires.
+	ExpiresAt time.Time
+	// ConsumedAt is when the token was redeemed. The zero value means the
+	// token has not been redeemed.
+	ConsumedAt time.Time
+}
+
+// Consumed reports whether the token has been redeemed.
+func (r BootstrapRecord) Consumed() bool { return !r.ConsumedAt.IsZero() }
+
+// Expired reports whether the token has expired at now.
+func (r BootstrapRecord) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// BootstrapStore persists bootstrap records, indexed by ID.
+//
+// Implementations must be safe for concurrent use and return ErrNotFound
+// (possibly wrapped) for unknown IDs.
+type BootstrapStore interface {
+	// GetBootstrap returns the record with the given ID, including consumed
+	// and expired ones.
+	GetBootstrap(ctx context.Context, id string) (BootstrapRecord, error)
+	// InsertBootstrap adds a new record, failing with ErrDuplicateID when
+	// its ID is already in use.
+	InsertBootstrap(ctx context.Context, rec BootstrapRecord) error
+	// ConsumeBootstrap marks the record consumed at the given time. It must
+	// be atomic: when several calls race for the same record exactly one
+	// succeeds, and the others, like any call for an already consumed
+	// record, fail with ErrConsumed.
+	ConsumeBootstrap(ctx context.Context, id string, at time.Time) error
+}
+
+// Issue generates a bootstrap token for id, provisioning logbookUID and
+// bound to claims as GenerateFor does, and stores its record in store. plain
+// is returned once and must be handed to the client together with id. The
+// claims are optional and are not stored; Redeem must be given them again.
+// Claims that name a logbook other than logbookUID are rejected with
+// ErrInvalidArgument.
+func (b *BootstrapIssuer) Issue(ctx context.Context, store BootstrapStore, id, logbookUID string, claims BootstrapClaims) (plain string, rec BootstrapRecord, err error) {
+	if id == "" {
+		return "", BootstrapRecord{}, bootstrapError(ErrInvalidArgument, "id", "empty id")
+	}
+	if claims.LogbookUID != "" && claims.LogbookUID != logbookUID {
+		return "", BootstrapRecord{}, bootstrapError(ErrInvalidArgument, "logbook", "claims bind a different logbook")
+	}
+	plain, hash, expires, err := b.GenerateFor(claims)
+	if err != nil {
+		return "", BootstrapRecord{}, err
+	}
+	rec = BootstrapRecord{ID: id, LogbookUID: logbookUID, Hash: hash, CreatedAt: b.now().UTC(), ExpiresAt: expires}
+	if err := store.InsertBootstrap(ctx, rec); err != nil {
+		return "", BootstrapRecord{}, fmt.Errorf("insert bootstrap record: %w", err)
+	}
+	return plain, rec, nil
+}
+
+// Redeem validates plain and claims against the record stored under id and
+// marks it consumed, so that each token is accepted at most once. Pass zero
+// claims for tokens issued without any. It returns the record with
+// ConsumedAt set. It fails with an error wrapping ErrNotFound for unknown
+// IDs, ErrMismatch for wrong tokens or claims, ErrExpired for expired ones and
+// ErrConsumed for tokens that were already redeemed, including by a
+// concurrent Redeem that won the race. Expiry and reuse are only reported
+// once the token has matched.
+func (b *BootstrapIssuer) Redeem(ctx context.Context, store BootstrapStore, id, plain string, claims BootstrapClaims) (BootstrapRecord, error) {
+	rec, err := b.redeem(ctx, store, id, plain, claims, nil)
+	b.logRedemption(ctx, id, err)
+	return rec, err
+}
+
+// logRedemption logs the outcome of redeeming the token stored under id.
+func (b *BootstrapIssuer) logRedemption(ctx context.Context, id string, err error) {
+	switch {
+	case err == nil:
+		b.log.LogAttrs(ctx, slog.LevelInfo, "bootstrap redeemed", slog.String("id", id))
+	case isCredentialError(err):
+		b.log.LogAttrs(ctx, slog.LevelInfo, "bootstrap rejected", slog.String("id", id), slog.Any("err", err))
+	default:
+		b.log.LogAttrs(ctx, slog.LevelError, "bootstrap redemption failed", slog.String("id", id), slog.Any("err", err))
+	}
+}
+
+// redeem implements Redeem. When check is not nil it is called with the
+// matching, unexpired record just before the token is consumed; an error
+// from it leaves the token redeemable.
+func (b *BootstrapIssuer) redeem(ctx context.Context, store BootstrapStore, id, plain string, claims BootstrapClaims, check func(BootstrapRecord) error) (BootstrapRecord, error) {
+	if id == "" || plain == "" {
+		return BootstrapRecord{}, bootstrapError(ErrEmpty, "", "empty id or token")
+	}
+	rec, err := store.GetBootstrap(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return BootstrapRecord{}, bootstrapError(ErrNotFound, "id", "unknown bootstrap id")
+		}
+		return BootstrapRecord{}, fmt.Errorf("get bootstrap record: %w", err)
+	}
+
+	ok, err := verifyBootstrap(plain, rec.Hash, claims, b.keyring)
+	if err != nil {
+		return BootstrapRecord{}, err
+	}
+	if !ok {
+		return BootstrapRecord{}, bootstrapError(ErrMismatch, "token", "does not match stored hash")
+	}
+
+	now := b.now()
+	if rec.Consumed() {
+		return BootstrapRecord{}, bootstrapError(ErrConsumed, "", "token already redeemed")
+	}
+	if rec.Expired(now) {
+		return BootstrapRecord{}, bootstrapError(ErrExpired, "", "token expired")
+	}
+	if check != nil {
+		if err := check(rec); err != nil {
+			return BootstrapRecord{}, err
+		}
+	}
+	if err := store.ConsumeBootstrap(ctx, id, now); err != nil {
+		if errors.Is(err, ErrConsumed) {
+			return BootstrapRecord{}, bootstrapError(ErrConsumed, "", "token already redeemed")
+		}
+		return BootstrapRecord{}, fmt.Errorf("consume bootstrap record: %w", err)
+	}
+	rec.ConsumedAt = now
+	return rec, nil
+}
+
+// Exchange trades a bootstrap token for an API key: it redeems plain and
+// claims as Redeem does and, in the same operation, generates a fresh key of
+// the kind GenerateApiKey returns, bound to the token's LogbookUID. fullKey
+// is returned once and must be handed to the client; rec carries only the
+// key's digest and must be persisted by the caller, e.g. with Store.Insert.
+//
+// When the issuer has a keyring (WithKeyring) the digest is keyed with its
+// current pepper, so rec validates with a Validator using the same keyring.
+//
+// The key is generated before the token is consumed, so a failing
+// randomness source or keyring leaves the token redeemable, as does a token
+// stored without a LogbookUID, which fails with ErrInvalidArgument. Exchange
+// otherwise fails with the same errors as Redeem.
+func (b *BootstrapIssuer) Exchange(ctx context.Context, store BootstrapStore, id, plain string, claims BootstrapClaims) (fullKey string, rec Record, err error) {
+	key, digest, err := b.exchangeKey()
+	if err != nil {
+		b.log.LogAttrs(ctx, slog.LevelError, "bootstrap exchange failed", slog.String("id", id), slog.Any("err", err))
+		return "", Record{}, err
+	}
+	boot, err := b.redeem(ctx, store, id, plain, claims, func(r BootstrapRecord) error {
+		if r.LogbookUID == "" {
+			return bootstrapError(ErrInvalidArgument, "logbook", "token is not bound to a logbook")
+		}
+		return nil
+	})
+	b.logRedemption(ctx, id, err)
+	if err != nil {
+		return "", Record{}, err
+	}
+	rec = Record{
+		Prefix:     key.Prefix(),
+		Digest:     digest,
+		LogbookUID: boot.LogbookUID,
+		Kind:       key.Kind(),
+		CreatedAt:  boot.ConsumedAt.UTC(),
+	}
+	b.log.LogAttrs(ctx, slog.LevelInfo, "bootstrap exchanged", slog.String("id", id), slog.Any("key", key))
+	return key.String(), rec, nil
+}
+
+// exchangeKey generates the key issued by Exchange and its digest.
+func (b *BootstrapIssuer) exchangeKey() (*Key, string, error) {
+	g, err := NewGenerator(WithRand(b.rand))
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := g.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+	if b.keyring == nil {
+		return key, key.Digest(), nil
+	}
+	digest, err := b.keyring.HashApiKeySecret(key.Secret())
+	if err != nil {
+		return nil, "", err
+	}
+	return key, digest, nil
+}
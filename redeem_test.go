@@ -0,0 +1,252 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// cheapArgon keeps Argon2id fast in tests that hash many tokens.
+var cheapArgon = WithArgon2Params(1, 1024, 1)
+
+func TestRedeem_SingleUse(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBootstrapIssuer(cheapArgon, WithClock(func() time.Time { return now }))
+
+	plain, rec, err := b.Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if rec.ID != "acct-1" || rec.LogbookUID != "lb-1" || rec.Consumed() || !rec.ExpiresAt.Equal(now.Add(DefaultBootstrapTTL)) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if _, _, err := b.Issue(ctx, store, "acct-1", "lb-1", c); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("expected ErrDuplicateID for reused id, got %v", err)
+	}
+
+	if _, err := b.Redeem(ctx, store, "acct-1", strings.Repeat("00", 32), c); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+	got, err := b.Redeem(ctx, store, "acct-1", plain, c)
+	if err != nil {
+		t.Fatalf("Redeem error: %v", err)
+	}
+	if !got.ConsumedAt.Equal(now) {
+		t.Fatalf("ConsumedAt = %v, want %v", got.ConsumedAt, now)
+	}
+	if _, err := b.Redeem(ctx, store, "acct-1", plain, c); !errors.Is(err, ErrConsumed) {
+		t.Fatalf("expected ErrConsumed on reuse, got %v", err)
+	}
+	// reuse is only reported to holders of the token
+	if _, err := b.Redeem(ctx, store, "acct-1", strings.Repeat("00", 32), c); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+	if _, err := b.Redeem(ctx, store, "acct-2", plain, c); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := b.Redeem(ctx, store, "", plain, c); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestRedeem_Expired(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBootstrapIssuer(cheapArgon, WithClock(func() time.Time { return now }), WithTTL(time.Minute))
+
+	plain, _, err := b.Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := b.Redeem(ctx, store, "acct-1", plain, c); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if rec, _ := store.GetBootstrap(ctx, "acct-1"); rec.Consumed() {
+		t.Fatalf("an expired token must not be consumed")
+	}
+}
+
+func TestRedeem_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	b := NewBootstrapIssuer(cheapArgon)
+	plain, _, err := b.Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+
+	const n = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	start := make(chan struct{})
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := b.Redeem(ctx, store, "acct-1", plain, c)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	ok := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, ErrConsumed):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("%d of %d parallel redemptions succeeded, want exactly 1", ok, n)
+	}
+}
+
+func TestRedeem_Keyring(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	kr, _ := NewKeyring(DigestHMACSHA256)
+	_ = kr.Add("b1", testPepper)
+	_ = kr.SetCurrent("b1")
+	b := NewBootstrapIssuer(WithKeyring(kr))
+
+	plain, _, err := b.Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if _, err := b.Redeem(ctx, store, "acct-1", plain, c); err != nil {
+		t.Fatalf("Redeem error: %v", err)
+	}
+	if _, err := b.Redeem(ctx, store, "acct-1", plain, c); !errors.Is(err, ErrConsumed) {
+		t.Fatalf("expected ErrConsumed, got %v", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBootstrapIssuer(cheapArgon, WithClock(func() time.Time { return now }))
+
+	plain, _, err := b.Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if _, _, err := b.Exchange(ctx, store, "acct-1", strings.Repeat("00", 32), c); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+	full, rec, err := b.Exchange(ctx, store, "acct-1", plain, c)
+	if err != nil {
+		t.Fatalf("Exchange error: %v", err)
+	}
+	if rec.LogbookUID != "lb-1" || !rec.CreatedAt.Equal(now) || strings.Contains(rec.Digest, full) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if err := store.Insert(ctx, rec); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	got, err := NewValidator(store).Validate(ctx, full)
+	if err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	if got.LogbookUID != "lb-1" {
+		t.Fatalf("key bound to %q, want lb-1", got.LogbookUID)
+	}
+
+	if _, _, err := b.Exchange(ctx, store, "acct-1", plain, c); !errors.Is(err, ErrConsumed) {
+		t.Fatalf("expected ErrConsumed on second exchange, got %v", err)
+	}
+}
+
+func TestExchange_LogbookWithoutClaims(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	b := NewBootstrapIssuer(cheapArgon)
+	plain, _, err := b.Issue(ctx, store, "acct-1", "lb-1", BootstrapClaims{})
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	_, rec, err := b.Exchange(ctx, store, "acct-1", plain, BootstrapClaims{})
+	if err != nil {
+		t.Fatalf("Exchange error: %v", err)
+	}
+	if rec.LogbookUID != "lb-1" {
+		t.Fatalf("key bound to %q, want lb-1", rec.LogbookUID)
+	}
+}
+
+func TestExchange_NoLogbookKeepsToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	b := NewBootstrapIssuer(cheapArgon)
+	plain, _, err := b.Issue(ctx, store, "acct-1", "", BootstrapClaims{})
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if _, _, err := b.Exchange(ctx, store, "acct-1", plain, BootstrapClaims{}); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+	if _, err := b.Redeem(ctx, store, "acct-1", plain, BootstrapClaims{}); err != nil {
+		t.Fatalf("token should not have been consumed, got %v", err)
+	}
+}
+
+func TestExchange_Keyring(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	kr := newTestKeyring(t)
+	b := NewBootstrapIssuer(cheapArgon, WithKeyring(kr))
+	plain, _, err := b.Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	full, rec, err := b.Exchange(ctx, store, "acct-1", plain, c)
+	if err != nil {
+		t.Fatalf("Exchange error: %v", err)
+	}
+	if kr.NeedsRehash(rec.Digest) {
+		t.Fatalf("expected a digest keyed with the current pepper, got %q", rec.Digest)
+	}
+	if err := store.Insert(ctx, rec); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if _, err := NewValidator(store, WithKeyring(kr)).Validate(ctx, full); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+}
+
+func TestExchange_RandFailureKeepsToken(t *testing.T) {
+	ctx := context.Background()
+	c := BootstrapClaims{LogbookUID: "lb-1"}
+	store := NewMemoryStore()
+	plain, _, err := NewBootstrapIssuer(cheapArgon).Issue(ctx, store, "acct-1", "lb-1", c)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	errEntropy := errors.New("entropy exhausted")
+	failing := NewBootstrapIssuer(cheapArgon, WithRand(iotest.ErrReader(errEntropy)))
+	if _, _, err := failing.Exchange(ctx, store, "acct-1", plain, c); !errors.Is(err, errEntropy) {
+		t.Fatalf("expected entropy error, got %v", err)
+	}
+	if _, _, err := NewBootstrapIssuer(cheapArgon).Exchange(ctx, store, "acct-1", plain, c); err != nil {
+		t.Fatalf("token should still be redeemable, got %v", err)
+	}
+}
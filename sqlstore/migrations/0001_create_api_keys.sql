@@ -0,0 +1,15 @@
+-- api_keys holds one row per issued API key. Only the digest of the secret
+-- is stored. Timestamps are written in UTC; NULL means "never".
+CREATE TABLE IF NOT EXISTS api_keys (
+    prefix       VARCHAR(16)  NOT NULL,
+    digest       VARCHAR(255) NOT NULL,
+    logbook_uid  VARCHAR(64)  NOT NULL,
+    created_at   TIMESTAMP    NOT NULL,
+    expires_at   TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_prefix_uidx ON api_keys (prefix);
+
+CREATE INDEX IF NOT EXISTS api_keys_logbook_uid_idx ON api_keys (logbook_uid);
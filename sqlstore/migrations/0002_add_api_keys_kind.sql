@@ -0,0 +1,5 @@
+-- kind is the apikey.Kind a key was issued with. The kind segment of a key is
+-- not covered by its digest, so the validator compares it with this column.
+-- Rows created before this migration get '' (no kind) and only validate keys
+-- without a kind segment.
+ALTER TABLE api_keys ADD COLUMN kind VARCHAR(8) NOT NULL DEFAULT '';
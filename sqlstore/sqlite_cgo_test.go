@@ -0,0 +1,7 @@
+//go:build cgo
+
+package sqlstore
+
+// The SQLite driver needs cgo; without it the tests that open a database are
+// skipped.
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,250 @@
+// Package sqlstore implements apikey.Store on top of database/sql.
+//
+// The queries stick to the subset of SQL shared by PostgreSQL and SQLite
+// (3.24 or later); the only dialect difference handled here is the
+// placeholder syntax. The schema is embedded and applied with Migrate, which
+// records the migrations it has run in the api_keys_migrations table.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Station-Manager/apikey"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Dialect selects the SQL placeholder style.
+type Dialect int
+
+const (
+	// Postgres uses $1, $2, ... placeholders.
+	Postgres Dialect = iota
+	// SQLite uses ? placeholders.
+	SQLite
+)
+
+// Store is an apikey.Store (and apikey.DigestUpdater) backed by the api_keys
+// table. It is safe for concurrent use to the extent the underlying *sql.DB
+// is.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var (
+	_ apikey.Store         = (*Store)(nil)
+	_ apikey.DigestUpdater = (*Store)(nil)
+)
+
+// New returns a Store using db. Call Migrate once before first use.
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db: db, dialect: dialect}
+}
+
+// Migrate applies the embedded migrations that have not run yet, in file
+// name order, each in its own transaction. It is safe to call on each
+// start-up. The first migration is idempotent, so databases created before
+// migrations were recorded are picked up as well.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS api_keys_migrations (name VARCHAR(255) NOT NULL PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.migrate(ctx, name); err != nil {
+			return fmt.Errorf("migrate %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// migrate runs the migration script name unless it is already recorded.
+func (s *Store) migrate(ctx context.Context, name string) error {
+	b, err := migrations.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var one int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT 1 FROM api_keys_migrations WHERE name = ?`), name).Scan(&one)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	for _, stmt := range splitStatements(string(b)) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO api_keys_migrations (name) VALUES (?)`), name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetByPrefix implements apikey.Store.
+func (s *Store) GetByPrefix(ctx context.Context, prefix string) (apikey.Record, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(
+		`SELECT prefix, digest, logbook_uid, kind, created_at, expires_at, revoked_at, last_used_at
+		   FROM api_keys WHERE prefix = ?`), prefix)
+	var (
+		rec                        apikey.Record
+		expires, revoked, lastUsed sql.NullTime
+	)
+	err := row.Scan(&rec.Prefix, &rec.Digest, &rec.LogbookUID, &rec.Kind, &rec.CreatedAt, &expires, &revoked, &lastUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apikey.Record{}, apikey.ErrNotFound
+	}
+	if err != nil {
+		return apikey.Record{}, err
+	}
+	rec.CreatedAt = rec.CreatedAt.UTC()
+	rec.ExpiresAt = fromNull(expires)
+	rec.RevokedAt = fromNull(revoked)
+	rec.LastUsedAt = fromNull(lastUsed)
+	return rec, nil
+}
+
+// Insert implements apikey.Store.
+func (s *Store) Insert(ctx context.Context, rec apikey.Record) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO api_keys (prefix, digest, logbook_uid, kind, created_at, expires_at, revoked_at, last_used_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (prefix) DO NOTHING`),
+		rec.Prefix, rec.Digest, rec.LogbookUID, string(rec.Kind), rec.CreatedAt.UTC(),
+		toNull(rec.ExpiresAt), toNull(rec.RevokedAt), toNull(rec.LastUsedAt))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return apikey.ErrDuplicatePrefix
+	}
+	return nil
+}
+
+// Revoke implements apikey.Store.
+func (s *Store) Revoke(ctx context.Context, prefix string, at time.Time) error {
+	return s.update(ctx, prefix,
+		`UPDATE api_keys SET revoked_at = ? WHERE prefix = ? AND revoked_at IS NULL`,
+		at.UTC(), prefix)
+}
+
+// TouchLastUsed implements apikey.Store. Out-of-order updates from concurrent
+// validations never move last_used_at backwards.
+func (s *Store) TouchLastUsed(ctx context.Context, prefix string, at time.Time) error {
+	at = at.UTC()
+	return s.update(ctx, prefix,
+		`UPDATE api_keys SET last_used_at = ?
+		  WHERE prefix = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		at, prefix, at)
+}
+
+// UpdateDigest implements apikey.DigestUpdater.
+func (s *Store) UpdateDigest(ctx context.Context, prefix, digest string) error {
+	return s.update(ctx, prefix,
+		`UPDATE api_keys SET digest = ? WHERE prefix = ?`,
+		digest, prefix)
+}
+
+// update runs a single-row UPDATE. When it changes nothing, the prefix is
+// looked up to tell a missing record (ErrNotFound) from an update that was
+// already applied.
+func (s *Store) update(ctx context.Context, prefix, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var one int
+	err = s.db.QueryRowContext(ctx, s.rebind(`SELECT 1 FROM api_keys WHERE prefix = ?`), prefix).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apikey.ErrNotFound
+	}
+	return err
+}
+
+// rebind rewrites ? placeholders for the store's dialect.
+func (s *Store) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteByte(query[i])
+	}
+	return sb.String()
+}
+
+// splitStatements splits a migration script into statements. Comment lines
+// are removed first so they may contain semicolons; statements themselves must
+// not contain semicolons inside string literals.
+func splitStatements(script string) []string {
+	var code []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			code = append(code, line)
+		}
+	}
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(code, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// toNull maps the zero time to SQL NULL.
+func toNull(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// fromNull maps SQL NULL to the zero time.
+func fromNull(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return t.Time.UTC()
+}
@@ -0,0 +1,221 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Station-Manager/apikey"
+)
+
+// openTestDB opens a fresh SQLite database, skipping the test when the
+// driver is not built in (it requires cgo).
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if !slices.Contains(sql.Drivers(), "sqlite3") {
+		t.Skip("sqlite3 driver not available (built without cgo)")
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "keys.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db := openTestDB(t)
+	db.SetMaxOpenConns(1)
+	s := New(db, SQLite)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	// migrations are only applied once
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatalf("second Migrate error: %v", err)
+	}
+	return s
+}
+
+func TestStore_CRUD(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	t0 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := s.GetByPrefix(ctx, "abcd"); !errors.Is(err, apikey.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	rec := apikey.Record{Prefix: "abcd", Digest: "digest", LogbookUID: "lb-1", Kind: apikey.KindReadOnly, CreatedAt: t0, ExpiresAt: t0.Add(24 * time.Hour)}
+	if err := s.Insert(ctx, rec); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if err := s.Insert(ctx, rec); !errors.Is(err, apikey.ErrDuplicatePrefix) {
+		t.Fatalf("expected ErrDuplicatePrefix, got %v", err)
+	}
+
+	got, err := s.GetByPrefix(ctx, "abcd")
+	if err != nil {
+		t.Fatalf("GetByPrefix error: %v", err)
+	}
+	if got != rec {
+		t.Fatalf("GetByPrefix = %+v, want %+v", got, rec)
+	}
+
+	if err := s.TouchLastUsed(ctx, "abcd", t0.Add(2*time.Minute)); err != nil {
+		t.Fatalf("TouchLastUsed error: %v", err)
+	}
+	if err := s.TouchLastUsed(ctx, "abcd", t0.Add(time.Minute)); err != nil {
+		t.Fatalf("TouchLastUsed (older) error: %v", err)
+	}
+	if err := s.Revoke(ctx, "abcd", t0.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	if err := s.Revoke(ctx, "abcd", t0.Add(2*time.Hour)); err != nil {
+		t.Fatalf("second Revoke error: %v", err)
+	}
+	if err := s.UpdateDigest(ctx, "abcd", "digest2"); err != nil {
+		t.Fatalf("UpdateDigest error: %v", err)
+	}
+	got, err = s.GetByPrefix(ctx, "abcd")
+	if err != nil {
+		t.Fatalf("GetByPrefix error: %v", err)
+	}
+	if !got.LastUsedAt.Equal(t0.Add(2 * time.Minute)) {
+		t.Fatalf("LastUsedAt = %v, want %v", got.LastUsedAt, t0.Add(2*time.Minute))
+	}
+	if !got.RevokedAt.Equal(t0.Add(time.Hour)) {
+		t.Fatalf("RevokedAt = %v, want original revocation time", got.RevokedAt)
+	}
+	if got.Digest != "digest2" {
+		t.Fatalf("Digest = %q, want digest2", got.Digest)
+	}
+
+	for _, err := range []error{
+		s.Revoke(ctx, "ffff", t0),
+		s.TouchLastUsed(ctx, "ffff", t0),
+		s.UpdateDigest(ctx, "ffff", "d"),
+	} {
+		if !errors.Is(err, apikey.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for unknown prefix, got %v", err)
+		}
+	}
+}
+
+func TestStore_WithValidator(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	v := apikey.NewValidator(s)
+
+	k, err := apikey.GenerateKey(apikey.KeySpec{PrefixLen: 12})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if err := s.Insert(ctx, apikey.Record{Prefix: k.Prefix(), Digest: k.Digest(), LogbookUID: "lb-1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Validate(ctx, k.String()); err != nil {
+				t.Errorf("Validate error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec, err := s.GetByPrefix(ctx, k.Prefix())
+	if err != nil {
+		t.Fatalf("GetByPrefix error: %v", err)
+	}
+	if rec.LastUsedAt.IsZero() {
+		t.Fatalf("expected last-used time to be recorded")
+	}
+
+	if err := s.Revoke(ctx, k.Prefix(), time.Now()); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	if _, err := v.Validate(ctx, k.String()); !errors.Is(err, apikey.ErrRevoked) {
+		t.Fatalf("expected ErrRevoked, got %v", err)
+	}
+}
+
+func TestStore_MigrateUnrecordedSchema(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	// a database created before migrations were recorded
+	b, err := migrations.ReadFile("migrations/0001_create_api_keys.sql")
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	for _, stmt := range splitStatements(string(b)) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("Exec error: %v", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO api_keys (prefix, digest, logbook_uid, created_at) VALUES ('abcd', 'd', 'lb', ?)`, time.Now().UTC()); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	s := New(db, SQLite)
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	rec, err := s.GetByPrefix(ctx, "abcd")
+	if err != nil {
+		t.Fatalf("GetByPrefix error: %v", err)
+	}
+	if rec.Kind != apikey.KindUnspecified {
+		t.Fatalf("existing rows should get no kind, got %q", rec.Kind)
+	}
+}
+
+func TestStore_RelabelledKind(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	full, prefix, hash, err := apikey.GenerateApiKeyKind(apikey.KindReadOnly, 12)
+	if err != nil {
+		t.Fatalf("GenerateApiKeyKind error: %v", err)
+	}
+	if err := s.Insert(ctx, apikey.Record{Prefix: prefix, Digest: hash, LogbookUID: "lb-1", Kind: apikey.KindReadOnly, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	v := apikey.NewValidator(s)
+	if _, err := v.Validate(ctx, full); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	_, secret, err := apikey.ParseApiKey(full)
+	if err != nil {
+		t.Fatalf("ParseApiKey error: %v", err)
+	}
+	if _, err := v.Validate(ctx, prefix+"_"+secret); !errors.Is(err, apikey.ErrMismatch) {
+		t.Fatalf("key stripped of its kind: got %v, want ErrMismatch", err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	pg := New(nil, Postgres)
+	if got := pg.rebind("a = ? AND b = ?"); got != "a = $1 AND b = $2" {
+		t.Fatalf("rebind = %q", got)
+	}
+	lite := New(nil, SQLite)
+	if got := lite.rebind("a = ?"); got != "a = ?" {
+		t.Fatalf("rebind = %q", got)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := splitStatements("-- comment; with a semicolon\nCREATE TABLE t (a INT);\n\n-- trailing\nCREATE INDEX i ON t (a);\n")
+	if len(stmts) != 2 {
+		t.Fatalf("expected 2 statements, got %d: %q", len(stmts), stmts)
+	}
+}
@@ -0,0 +1,66 @@
+package apikey
+
+import (
+	"context"
+	"time"
+)
+
+// Record is the server-side state of an API key. It never holds the secret,
+// only its digest.
+type Record struct {
+	// Prefix is the key's lookup prefix and the record's unique identifier.
+	Prefix string
+	// Digest is the stored digest of the secret, as returned by
+	// HashApiKeySecret, HashApiKeySecretHMAC or Keyring.HashApiKeySecret.
+	Digest string
+	// LogbookUID is the logbook the key belongs to.
+	LogbookUID string
+	// Kind is the kind the key was issued with. A Validator only accepts the
+	// key when its kind segment matches, since the segment itself is not
+	// covered by the digest.
+	Kind Kind
+	// CreatedAt is when the key was issued.
+	CreatedAt time.Time
+	// ExpiresAt is when the key stops being valid. The zero value means the
+	// key never expires.
+	ExpiresAt time.Time
+	// RevokedAt is when the key was revoked. The zero value means the key is
+	// not revoked.
+	RevokedAt time.Time
+	// LastUsedAt is when the key last validated successfully.
+	LastUsedAt time.Time
+}
+
+// Revoked reports whether the record has been revoked.
+func (r Record) Revoked() bool { return !r.RevokedAt.IsZero() }
+
+// Expired reports whether the record has expired at now.
+func (r Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// Store persists API key records, indexed by prefix.
+//
+// Implementations must be safe for concurrent use and return ErrNotFound
+// (possibly wrapped) for unknown prefixes.
+type Store interface {
+	// GetByPrefix returns the record with the given prefix, including revoked
+	// and expired ones.
+	GetByPrefix(ctx context.Context, prefix string) (Record, error)
+	// Insert adds a new record, failing with ErrDuplicatePrefix when its
+	// prefix is already in use.
+	Insert(ctx context.Context, rec Record) error
+	// Revoke marks the record revoked at the given time. Revoking an already
+	// revoked record keeps the original time.
+	Revoke(ctx context.Context, prefix string, at time.Time) error
+	// TouchLastUsed records a successful validation at the given time.
+	TouchLastUsed(ctx context.Context, prefix string, at time.Time) error
+}
+
+// DigestUpdater is implemented by stores that can replace a record's digest.
+// When the Store given to a Validator implements it, digests that the
+// Validator's Keyring reports as outdated are re-hashed after a successful
+// validation.
+type DigestUpdater interface {
+	UpdateDigest(ctx context.Context, prefix, digest string) error
+}
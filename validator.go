@@ -0,0 +1,161 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Validator authenticates full API keys against a Store: it parses the key,
+// looks the record up by prefix, compares the digest in constant time,
+// rejects revoked and expired keys and records the successful use.
+//
+// A Validator is safe for concurrent use.
+type Validator struct {
+	store   Store
+	parse   func(string) (*Key, error)
+	keyring *Keyring
+	kinds   []Kind
+	now     func() time.Time
+	log     *slog.Logger
+}
+
+// ValidatorOption configures a Validator.
+type ValidatorOption interface {
+	applyValidator(*Validator)
+}
+
+// validatorOptionFunc adapts a function to ValidatorOption.
+type validatorOptionFunc func(*Validator)
+
+func (f validatorOptionFunc) applyValidator(v *Validator) { f(v) }
+
+// WithAllowedKinds restricts the Validator to keys of the given kinds; other
+// keys fail with ErrKindNotAllowed before any storage lookup. Include
+// KindUnspecified to accept keys without a kind segment. Without
+// WithAllowedKinds every kind is accepted; WithAllowedKinds with no kinds
+// accepts none.
+func WithAllowedKinds(kinds ...Kind) ValidatorOption {
+	// never nil, so that an empty list does not fall back to allowing all
+	return validatorOptionFunc(func(v *Validator) { v.kinds = append([]Kind{}, kinds...) })
+}
+
+// WithGenerator makes the Validator parse keys with g.Parse instead of
+// ParseKey, for keys issued with a custom layout.
+func WithGenerator(g *Generator) ValidatorOption {
+	return validatorOptionFunc(func(v *Validator) { v.parse = g.Parse })
+}
+
+// NewValidator returns a Validator backed by store.
+func NewValidator(store Store, opts ...ValidatorOption) *Validator {
+	v := &Validator{store: store, parse: ParseKey, now: time.Now, log: discardLogger}
+	for _, opt := range opts {
+		opt.applyValidator(v)
+	}
+	return v
+}
+
+// Validate authenticates fullKey and returns the owning record with
+// LastUsedAt updated. It fails with an error wrapping ErrMalformed,
+// ErrChecksumMismatch or ErrKindNotAllowed for keys rejected before lookup,
+// ErrNotFound for unknown prefixes, ErrMismatch for wrong secrets or for
+// keys whose kind segment differs from Record.Kind, and ErrRevoked or
+// ErrExpired for keys that match but are no longer active.
+// Revocation and expiry are only reported once the secret has matched, so
+// they reveal nothing to someone who only knows a prefix.
+func (v *Validator) Validate(ctx context.Context, fullKey string) (Record, error) {
+	key, err := v.parse(fullKey)
+	if err != nil {
+		v.log.LogAttrs(ctx, slog.LevelInfo, "api key rejected", slog.Any("err", err))
+		return Record{}, err
+	}
+	rec, err := v.validate(ctx, key)
+	switch {
+	case err == nil:
+		v.log.LogAttrs(ctx, slog.LevelDebug, "api key validated", slog.Any("key", key))
+	case isCredentialError(err):
+		v.log.LogAttrs(ctx, slog.LevelInfo, "api key rejected", slog.Any("key", key), slog.Any("err", err))
+	default:
+		v.log.LogAttrs(ctx, slog.LevelError, "api key validation failed", slog.Any("key", key), slog.Any("err", err))
+	}
+	return rec, err
+}
+
+// validate implements Validate for a parsed key.
+func (v *Validator) validate(ctx context.Context, key *Key) (Record, error) {
+	if v.kinds != nil && !slices.Contains(v.kinds, key.Kind()) {
+		return Record{}, keyError(ErrKindNotAllowed, "kind", "kind not allowed")
+	}
+	rec, err := v.store.GetByPrefix(ctx, key.Prefix())
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Record{}, keyError(ErrNotFound, "prefix", "unknown prefix")
+		}
+		return Record{}, fmt.Errorf("get api key record: %w", err)
+	}
+
+	var ok, rehash bool
+	if v.keyring != nil {
+		ok, rehash, err = v.keyring.verify(key.Secret(), rec.Digest)
+	} else {
+		ok, err = verifySecret(key.Secret(), rec.Digest, nil)
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if !ok {
+		return Record{}, keyError(ErrMismatch, "secret", "does not match stored digest")
+	}
+	// The kind segment is not covered by the digest; only the stored kind
+	// is authoritative.
+	if key.Kind() != rec.Kind {
+		return Record{}, keyError(ErrMismatch, "kind", "does not match issued kind")
+	}
+
+	now := v.now()
+	if rec.Revoked() {
+		return Record{}, keyError(ErrRevoked, "", "key revoked")
+	}
+	if rec.Expired(now) {
+		return Record{}, keyError(ErrExpired, "", "key expired")
+	}
+	if err := v.store.TouchLastUsed(ctx, rec.Prefix, now); err != nil {
+		return Record{}, fmt.Errorf("touch api key record: %w", err)
+	}
+	rec.LastUsedAt = now
+
+	if rehash {
+		// Upgrading the digest is best effort: a failure leaves the old
+		// digest in place and the upgrade is retried on the next use.
+		if u, isUpdater := v.store.(DigestUpdater); isUpdater {
+			d, err := v.keyring.HashApiKeySecret(key.Secret())
+			if err == nil {
+				err = u.UpdateDigest(ctx, rec.Prefix, d)
+			}
+			if err != nil {
+				v.log.LogAttrs(ctx, slog.LevelWarn, "api key digest upgrade failed", slog.Any("key", key), slog.Any("err", err))
+			} else {
+				rec.Digest = d
+				v.log.LogAttrs(ctx, slog.LevelInfo, "api key digest upgraded", slog.Any("key", key))
+			}
+		}
+	}
+	return rec, nil
+}
+
+// isCredentialError reports whether err rejects the presented credential, as
+// opposed to a storage or configuration failure.
+func isCredentialError(err error) bool {
+	for _, target := range []error{
+		ErrEmpty, ErrMalformed, ErrChecksumMismatch, ErrKindNotAllowed,
+		ErrNotFound, ErrMismatch, ErrRevoked, ErrExpired, ErrConsumed,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidatorValidate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := NewValidator(store, WithClock(func() time.Time { return now }))
+
+	k, err := GenerateKey(KeySpec{PrefixLen: 8})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if err := store.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest(), LogbookUID: "lb-1", CreatedAt: now}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	rec, err := v.Validate(ctx, k.String())
+	if err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	if rec.LogbookUID != "lb-1" || !rec.LastUsedAt.Equal(now) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	stored, _ := store.GetByPrefix(ctx, k.Prefix())
+	if !stored.LastUsedAt.Equal(now) {
+		t.Fatalf("last used time was not persisted")
+	}
+}
+
+func TestValidatorValidate_Failures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := NewValidator(store, WithClock(func() time.Time { return now }))
+
+	insert := func(mod func(*Record)) *Key {
+		k, err := GenerateKey(KeySpec{PrefixLen: 12})
+		if err != nil {
+			t.Fatalf("GenerateKey error: %v", err)
+		}
+		rec := Record{Prefix: k.Prefix(), Digest: k.Digest(), LogbookUID: "lb", CreatedAt: now}
+		if mod != nil {
+			mod(&rec)
+		}
+		if err := store.Insert(ctx, rec); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+		return k
+	}
+
+	unknown, _ := GenerateKey(KeySpec{PrefixLen: 12})
+	wrong := insert(func(r *Record) { r.Digest = HashApiKeySecret("ABCD-EFGH-JKMN-PQRS-TUVW") })
+	revoked := insert(func(r *Record) { r.RevokedAt = now.Add(-time.Hour) })
+	expired := insert(func(r *Record) { r.ExpiresAt = now })
+
+	cases := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"malformed", "not-a-key", ErrMalformed},
+		{"unknown", unknown.String(), ErrNotFound},
+		{"mismatch", wrong.String(), ErrMismatch},
+		{"revoked", revoked.String(), ErrRevoked},
+		{"expired", expired.String(), ErrExpired},
+	}
+	for _, tc := range cases {
+		if _, err := v.Validate(ctx, tc.key); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestValidatorValidate_AllowedKinds(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	v := NewValidator(store, WithAllowedKinds(KindLive))
+
+	k, err := GenerateKey(KeySpec{Kind: KindTest})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if err := store.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if _, err := v.Validate(ctx, k.String()); !errors.Is(err, ErrKindNotAllowed) {
+		t.Fatalf("expected ErrKindNotAllowed, got %v", err)
+	}
+
+	// an explicitly empty list allows nothing rather than everything
+	var none []Kind
+	for _, v := range []*Validator{NewValidator(store, WithAllowedKinds()), NewValidator(store, WithAllowedKinds(none...))} {
+		if _, err := v.Validate(ctx, k.String()); !errors.Is(err, ErrKindNotAllowed) {
+			t.Fatalf("empty allow list: expected ErrKindNotAllowed, got %v", err)
+		}
+	}
+}
+
+// countingStore is a MemoryStore that counts digest rewrites.
+type countingStore struct {
+	*MemoryStore
+	updated int
+}
+
+func (s *countingStore) UpdateDigest(ctx context.Context, prefix, digest string) error {
+	s.updated++
+	return s.MemoryStore.UpdateDigest(ctx, prefix, digest)
+}
+
+func TestValidatorValidate_KeyringRehash(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	kr := newTestKeyring(t)
+	v := NewValidator(store, WithKeyring(kr))
+
+	// a key stored with the old unkeyed digest is upgraded on first use
+	k, err := GenerateKey(KeySpec{PrefixLen: 8})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if err := store.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	rec, err := v.Validate(ctx, k.String())
+	if err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	stored, err := store.GetByPrefix(ctx, k.Prefix())
+	if err != nil {
+		t.Fatalf("GetByPrefix error: %v", err)
+	}
+	if store.updated != 1 || kr.NeedsRehash(rec.Digest) || stored.Digest != rec.Digest {
+		t.Fatalf("expected digest to be upgraded, updated=%d got %q (stored %q)", store.updated, rec.Digest, stored.Digest)
+	}
+	if _, err := v.Validate(ctx, k.String()); err != nil {
+		t.Fatalf("Validate after upgrade error: %v", err)
+	}
+	if store.updated != 1 {
+		t.Fatalf("current digests must not be rewritten")
+	}
+
+	// without a keyring keyed digests cannot be checked
+	if _, err := NewValidator(store).Validate(ctx, k.String()); !errors.Is(err, ErrPepperRequired) {
+		t.Fatalf("expected ErrPepperRequired, got %v", err)
+	}
+}
+
+func TestValidatorValidate_RelabelledKind(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	k, err := GenerateKey(KeySpec{Kind: KindReadOnly})
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	if err := store.Insert(ctx, Record{Prefix: k.Prefix(), Digest: k.Digest(), Kind: KindReadOnly, LogbookUID: "lb", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	v := NewValidator(store, WithAllowedKinds(KindLive, KindReadOnly, KindUnspecified))
+	if _, err := v.Validate(ctx, k.String()); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	for _, forged := range []string{relabel(k, KindLive), relabel(k, KindUnspecified)} {
+		if _, err := v.Validate(ctx, forged); !errors.Is(err, ErrMismatch) {
+			t.Fatalf("relabelled key %q: got %v, want ErrMismatch", forged, err)
+		}
+	}
+	if _, err := NewValidator(store, WithAllowedKinds(KindLive)).Validate(ctx, relabel(k, KindLive)); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("a key relabelled into an allowed kind must not validate, got %v", err)
+	}
+}